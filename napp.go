@@ -1,14 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"go/format"
+	"go/token"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/joho/godotenv"
+	"github.com/mattn/go-isatty"
 	"github.com/urfave/cli"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
@@ -24,314 +44,4477 @@ func main() {
 		Version:   "v1.3.1",
 		Description: `A command line tool that bootstraps Go, HTMX and SQLite web
 	 applications and Dockerises them for ease of deployment`,
+		EnableBashCompletion: true,
+		BashComplete:         cli.DefaultAppComplete,
+		Action: func(cCtx *cli.Context) error {
+			if cCtx.NArg() > 0 {
+				return cli.NewExitError(
+					"Oops! "+strconv.Quote(cCtx.Args().First())+" is not a napp command, see napp --help",
+					exitInvalidArgs,
+				)
+			}
+
+			return cli.ShowAppHelp(cCtx)
+		},
 		Commands: []cli.Command{
 			{
 				Name:      "init",
 				ShortName: "i",
 				Usage:     "Initialise a new napp project ready for development",
-				UsageText: "napp init <project-name>",
+				UsageText: "napp init [command options] [project-name]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "css",
+						Value: "minimal",
+						Usage: "stylesheet setup to scaffold, either minimal or tailwind",
+					},
+					cli.BoolFlag{
+						Name:  "air",
+						Usage: "generate an .air.toml and a make dev target for live reload",
+					},
+					cli.BoolFlag{
+						Name:  "minimal",
+						Usage: "scaffold just a home page without auth, sessions or a database",
+					},
+					cli.StringFlag{
+						Name:  "template-engine",
+						Value: "html",
+						Usage: "how pages are written, either html for html/template or templ, templ needs --minimal",
+					},
+					cli.BoolFlag{
+						Name:  "embed",
+						Usage: "embed templates and static files into the binary for single file deploys",
+					},
+					cli.BoolFlag{
+						Name:  "git",
+						Usage: "initialise a git repository with an initial commit",
+					},
+					cli.StringFlag{
+						Name:  "session-store",
+						Value: "cookie",
+						Usage: "where to keep session data, either cookie or db",
+					},
+					cli.StringFlag{
+						Name:  "db",
+						Value: "sqlite",
+						Usage: "database to scaffold for, either sqlite or mysql",
+					},
+					cli.StringFlag{
+						Name:  "dir",
+						Usage: "directory to create the project in, defaults to the current directory",
+					},
+					cli.StringFlag{
+						Name:  "deploy",
+						Usage: "generate config for a deployment target, one of fly, render, railway or dokku",
+					},
+					cli.BoolFlag{
+						Name:  "no-docker",
+						Usage: "leave out the Dockerfile, .dockerignore and docker make targets, for deploys without containers",
+					},
+					cli.StringFlag{
+						Name:  "htmx-version",
+						Usage: "download this exact htmx release instead of the bundled " + bundledHtmxVersion,
+					},
+					cli.StringSliceFlag{
+						Name:  "with",
+						Usage: "also copy a companion library into static and link it in the layout, one of " + strings.Join(staticExtraNames(), " or ") + ", comma separated or repeated for more than one",
+					},
+					cli.StringFlag{
+						Name:  "go-version",
+						Usage: "Go release for the go.mod go line and the Dockerfile builder image, defaults to the Go napp was built with",
+					},
+					cli.StringFlag{
+						Name:  "description",
+						Usage: "one line describing the project, used for the meta description, README and main.go",
+					},
+					cli.BoolTFlag{
+						Name:  "with-readme",
+						Usage: "write a README.md with the run commands, env vars and deployment notes, on by default, pass --with-readme=false to leave it out",
+					},
+					cli.StringFlag{
+						Name:  "oauth",
+						Usage: "add sign in with github, google or both, for example github,google",
+					},
+					cli.BoolFlag{
+						Name:  "migrations",
+						Usage: "manage the schema with versioned SQL files in migrations/ instead of AutoMigrate",
+					},
+					cli.BoolFlag{
+						Name:  "avatars",
+						Usage: "add avatar uploads to the account pages",
+					},
+					cli.BoolFlag{
+						Name:  "worker",
+						Usage: "generate a worker.go for background jobs with an example cleanup job",
+					},
+					cli.BoolFlag{
+						Name:  "sse",
+						Usage: "add a GET /events server-sent events stream and a live update on the home page",
+					},
+					cli.BoolFlag{
+						Name:  "manifest",
+						Usage: "generate a web app manifest so the site can be installed",
+					},
+					cli.StringFlag{
+						Name:  "license",
+						Usage: "write a LICENSE file, one of MIT, Apache-2.0 or BSD-3-Clause",
+					},
+					cli.StringFlag{
+						Name:  "author",
+						Usage: "copyright holder named in the LICENSE file",
+					},
+					cli.BoolFlag{
+						Name:  "license-header",
+						Usage: "add a copyright and SPDX license comment to the top of generated .go files",
+					},
+					cli.BoolFlag{
+						Name:  "force",
+						Usage: "create the project even when the directory is inside another Go module",
+					},
+					cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "print the files, title and settings init would create without writing anything",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					projectname := cCtx.Args().Get(0)
+					if projectname == "" && isTerminal(os.Stdin) {
+						name, err := promptProjectName(os.Stdin, os.Stdout)
+						if err != nil {
+							return cli.NewExitError("Oops! "+err.Error(), exitInvalidArgs)
+						}
+						projectname = name
+					}
+
+					if len(cCtx.Args()) > 1 || projectname == "" {
+						msg := fmt.Sprintf(
+							"Oops! Received %v arguments, wanted 1",
+							len(cCtx.Args()),
+						)
+						return cli.NewExitError(msg, exitInvalidArgs)
+					}
+
+					// the project can be given as a path, or placed under --dir,
+					// either way it is named after the last path segment
+					projectDir := filepath.Join(cCtx.String("dir"), projectname)
+					title := projectTitle(filepath.Base(projectDir))
+
+					projectname, err := normaliseProjectName(filepath.Base(projectDir))
+					if err != nil {
+						return cli.NewExitError("Oops! "+err.Error(), exitInvalidArgs)
+					}
+					projectDir = filepath.Join(filepath.Dir(projectDir), projectname)
+
+					opts := projectOptions{
+						css:          cCtx.String("css"),
+						git:          cCtx.Bool("git"),
+						air:          cCtx.Bool("air"),
+						embed:        cCtx.Bool("embed"),
+						minimal:      cCtx.Bool("minimal"),
+						templ:        cCtx.String("template-engine") == "templ",
+						deploy:       cCtx.String("deploy"),
+						sessionStore: cCtx.String("session-store"),
+						htmxVersion:  cCtx.String("htmx-version"),
+						extras:       splitList(strings.Join(cCtx.StringSlice("with"), ",")),
+						goVersion:    cCtx.String("go-version"),
+						db:           cCtx.String("db"),
+						migrations:   cCtx.Bool("migrations"),
+						manifest:     cCtx.Bool("manifest"),
+						worker:       cCtx.Bool("worker"),
+						avatars:      cCtx.Bool("avatars"),
+						sse:          cCtx.Bool("sse"),
+						oauth:        splitList(cCtx.String("oauth")),
+						description:  strings.Join(strings.Fields(cCtx.String("description")), " "),
+						readme:       cCtx.BoolT("with-readme"),
+						title:        title,
+						license:      cCtx.String("license"),
+						author:       strings.TrimSpace(cCtx.String("author")),
+						header:       cCtx.Bool("license-header"),
+						noDocker:     cCtx.Bool("no-docker"),
+						force:        cCtx.Bool("force"),
+					}
+
+					if isInvalidCss(opts.css) {
+						return cli.NewExitError(
+							"Oops! CSS option must be one of the following: minimal, tailwind",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidTemplateEngine(cCtx.String("template-engine")) {
+						return cli.NewExitError(
+							"Oops! Template engine option must be one of the following: html, templ",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.templ && !opts.minimal {
+						return cli.NewExitError(
+							"Oops! --template-engine templ is only available with --minimal for now",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidDb(opts.db) {
+						return cli.NewExitError(
+							"Oops! Database option must be one of the following: sqlite, mysql",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && opts.db != "sqlite" {
+						return cli.NewExitError(
+							"Oops! --minimal projects have no database, leave out --db",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidOAuth(opts.oauth) {
+						return cli.NewExitError(
+							"Oops! OAuth option must be one or more of the following: github, google",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && len(opts.oauth) > 0 {
+						return cli.NewExitError(
+							"Oops! --minimal projects have no users to sign in, leave out --oauth",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && opts.avatars {
+						return cli.NewExitError(
+							"Oops! --minimal projects have no users to give avatars to, leave out --avatars",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && opts.worker {
+						return cli.NewExitError(
+							"Oops! --minimal projects have no database for jobs to work on, leave out --worker",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && opts.migrations {
+						return cli.NewExitError(
+							"Oops! --minimal projects have no database to migrate, leave out --migrations",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.deploy != "" && opts.db != "sqlite" {
+						return cli.NewExitError(
+							"Oops! The --deploy configs keep a SQLite database on a volume, leave out --deploy with --db mysql",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.deploy != "" && opts.noDocker {
+						return cli.NewExitError(
+							"Oops! The --deploy configs build the Dockerfile, leave out --deploy with --no-docker",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidSessionStore(opts.sessionStore) {
+						return cli.NewExitError(
+							"Oops! Session store option must be one of the following: cookie, db",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.minimal && opts.sessionStore == "db" {
+						return cli.NewExitError(
+							"Oops! The db session store needs a database, which --minimal leaves out",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.htmxVersion != "" && isInvalidHtmxVersion(opts.htmxVersion) {
+						return cli.NewExitError(
+							"Oops! htmx version must be an exact release, for example: "+bundledHtmxVersion,
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidExtras(opts.extras) {
+						return cli.NewExitError(
+							"Oops! --with must be one or more of the following: "+strings.Join(staticExtraNames(), ", "),
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.sse && opts.templ {
+						return cli.NewExitError(
+							"Oops! --sse is only available with --template-engine html for now",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.sse && strings.HasPrefix(opts.htmxVersion, "1.") {
+						return cli.NewExitError(
+							"Oops! --sse uses the htmx 2 extension API, leave out --htmx-version or pick a 2.x release",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidDeploy(opts.deploy) {
+						return cli.NewExitError(
+							"Oops! Deploy option must be one of the following: fly, render, railway, dokku",
+							exitInvalidArgs,
+						)
+					}
+
+					if isInvalidLicense(opts.license) {
+						return cli.NewExitError(
+							"Oops! License option must be one of the following: MIT, Apache-2.0, BSD-3-Clause",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.license != "" && opts.author == "" {
+						return cli.NewExitError(
+							"Oops! --license needs an --author to name as the copyright holder",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.license == "" && (opts.author != "" || opts.header) {
+						return cli.NewExitError(
+							"Oops! --author and --license-header are only used with --license",
+							exitInvalidArgs,
+						)
+					}
+
+					if opts.goVersion == "" {
+						opts.goVersion = defaultGoVersion(opts.minGoVersion())
+					}
+
+					if isInvalidGoVersion(opts.goVersion) {
+						return cli.NewExitError(
+							"Oops! Go version must be a release such as 1.22 or 1.22.4",
+							exitInvalidArgs,
+						)
+					}
+
+					if compareGoVersions(opts.goVersion, opts.minGoVersion()) < 0 {
+						return cli.NewExitError(
+							"Oops! The modules this project uses need Go "+opts.minGoVersion()+" or newer, got --go-version "+opts.goVersion,
+							exitInvalidArgs,
+						)
+					}
+
+					if cCtx.Bool("dry-run") {
+						err := printProjectPlan(os.Stdout, projectDir, opts)
+						if err != nil {
+							return exitWith(err)
+						}
+
+						return nil
+					}
+
+					ok, err := createProject(projectDir, opts)
+					if err != nil {
+						return exitWith(err)
+					}
+					if ok {
+						fmt.Println("Successfully created " + projectname + " with htmx " + installedHtmxVersion(projectDir) + ", next steps:")
+						fmt.Println("cd " + projectDir)
+						if opts.templ {
+							fmt.Println("go install github.com/a-h/templ/cmd/templ@latest")
+							fmt.Println("templ generate")
+						}
+						if opts.db == "mysql" {
+							fmt.Println("create the MySQL database named in .env and set MYSQL_USER and MYSQL_PASSWORD")
+						}
+						if opts.css == "tailwind" {
+							fmt.Println("npm install")
+							fmt.Println("npm run build:css")
+						}
+						if opts.air {
+							fmt.Println("go install github.com/air-verse/air@latest")
+							fmt.Println("make dev")
+						} else {
+							fmt.Println("go run " + opts.mainPackage())
+						}
+						if opts.deploy != "" {
+							printDeploySteps(projectname, opts.deploy)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:      "doctor",
+				Usage:     "Check that the napp project in the current directory is runnable",
+				UsageText: "napp doctor",
+				Action: func(cCtx *cli.Context) error {
+					projectDir, err := filepath.Abs(".")
+					if err != nil {
+						return exitWith(err)
+					}
+
+					if !runDoctor(projectDir) {
+						return cli.NewExitError("Oops! Some checks failed, see above for details", exitValidation)
+					}
+
+					fmt.Println("Everything looks good!")
+
+					return nil
+				},
+			},
+			{
+				Name:      "regen",
+				Usage:     "Regenerate a single file in the napp project in the current directory",
+				UsageText: "napp regen [command options] <file>\n\n   files: " + strings.Join(regenFileNames(), ", "),
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "yes, y",
+						Usage: "overwrite the file without asking",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					if len(cCtx.Args()) != 1 {
+						msg := fmt.Sprintf(
+							"Oops! Received %v arguments, wanted 1",
+							len(cCtx.Args()),
+						)
+						return cli.NewExitError(msg, exitInvalidArgs)
+					}
+
+					target, ok := findRegenFile(cCtx.Args().Get(0))
+					if !ok {
+						return cli.NewExitError(
+							"Oops! File must be one of the following: "+strings.Join(regenFileNames(), ", "),
+							exitInvalidArgs,
+						)
+					}
+
+					if !isNappProject(".") {
+						return cli.NewExitError(
+							"Oops! This command must be run from the root of a napp project",
+							exitValidation,
+						)
+					}
+
+					projectDir, err := filepath.Abs(".")
+					if err != nil {
+						return exitWith(err)
+					}
+
+					_, err = os.Stat(filepath.Join(projectDir, target.path))
+					if err == nil && !cCtx.Bool("yes") {
+						overwrite, err := confirmOverwrite(os.Stdin, os.Stdout, target.path)
+						if err != nil {
+							return exitWith(err)
+						}
+						if !overwrite {
+							fmt.Println("Left " + target.path + " unchanged")
+							return nil
+						}
+					}
+
+					target.create(projectDir, detectProjectOptions(projectDir))
+
+					fmt.Println("Successfully regenerated " + target.path)
+
+					return nil
+				},
+			},
+			{
+				Name:      "upgrade",
+				Usage:     "Refresh the boilerplate files in the napp project in the current directory",
+				UsageText: "napp upgrade",
+				Action: func(cCtx *cli.Context) error {
+					if !isNappProject(".") {
+						return cli.NewExitError(
+							"Oops! This command must be run from the root of a napp project",
+							exitValidation,
+						)
+					}
+
+					projectDir, err := filepath.Abs(".")
+					if err != nil {
+						return exitWith(err)
+					}
+
+					backupDir := filepath.Join(".napp-backup", time.Now().Format("20060102-150405"))
+
+					upgraded, err := upgradeProject(projectDir, filepath.Join(projectDir, backupDir))
+					if err != nil {
+						return exitWith(err)
+					}
+
+					if len(upgraded) == 0 {
+						fmt.Println("Everything is already up to date")
+						return nil
+					}
+
+					for _, path := range upgraded {
+						fmt.Println("Upgraded " + path)
+					}
+
+					_, err = os.Stat(backupDir)
+					if err == nil {
+						fmt.Println("The previous versions were backed up to " + backupDir)
+					}
+
+					fmt.Println("main.go and the templates are never upgraded, compare them with napp list --out")
+
+					return nil
+				},
+			},
+			{
+				Name:      "list",
+				Usage:     "List the templates napp generates projects from",
+				UsageText: "napp list [command options]",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "out",
+						Usage: "also write the templates, unfilled, to this directory",
+					},
+				},
+				Action: func(cCtx *cli.Context) error {
+					err := listSourceFiles(os.Stdout)
+					if err != nil {
+						return exitWith(err)
+					}
+
+					outDir := cCtx.String("out")
+					if outDir == "" {
+						return nil
+					}
+
+					err = dumpSourceFiles(outDir)
+					if err != nil {
+						return exitWith(err)
+					}
+
+					fmt.Println("Successfully wrote the templates to " + outDir)
+
+					return nil
+				},
+			},
+			{
+				Name:      "generate",
+				ShortName: "g",
+				Usage:     "Generate additional code into an existing napp project",
+				Subcommands: []cli.Command{
+					{
+						Name:      "ui-kit",
+						Usage:     "Generate reusable twcolors components and a /ui-kit showcase page",
+						UsageText: "napp generate ui-kit",
+						Action: func(cCtx *cli.Context) error {
+							if !isNappProject(".") {
+								return cli.NewExitError(
+									"Oops! This command must be run from the root of a napp project",
+									exitValidation,
+								)
+							}
+
+							err := generateUiKit(".")
+							if err != nil {
+								return exitWith(err)
+							}
+
+							fmt.Println("Successfully generated the ui kit, next steps:")
+							fmt.Println(runCommand("."))
+							fmt.Println("visit /ui-kit to see the components")
+							fmt.Println("link static/components.css in any page that uses them")
+
+							return nil
+						},
+					},
+					{
+						Name:      "model",
+						Usage:     "Generate a gorm model with CRUD handlers, templates and routes",
+						UsageText: "napp generate model <ModelName> [field:type...]\n\n   field types: string, text, int, float, bool",
+						Action: func(cCtx *cli.Context) error {
+							if len(cCtx.Args()) < 1 {
+								return cli.NewExitError("Oops! Received 0 arguments, wanted a model name", exitInvalidArgs)
+							}
+
+							modelname := cCtx.Args().Get(0)
+
+							if isInvalidModelName(modelname) {
+								return cli.NewExitError(
+									"Oops! Model name must be a valid Go identifier, for example: Post",
+									exitInvalidArgs,
+								)
+							}
+
+							if !isNappProject(".") {
+								return cli.NewExitError(
+									"Oops! This command must be run from the root of a napp project",
+									exitValidation,
+								)
+							}
+
+							spec, err := newModelSpec(modelname, cCtx.Args().Tail())
+							if err != nil {
+								return cli.NewExitError("Oops! "+err.Error(), exitInvalidArgs)
+							}
+
+							err = generateModel(".", spec)
+							if err != nil {
+								return exitWith(err)
+							}
+
+							fmt.Println("Successfully generated " + spec.Model + ", next steps:")
+							fmt.Println(runCommand("."))
+							fmt.Println("visit /" + spec.Route)
+
+							return nil
+						},
+					},
+					{
+						Name:      "page",
+						Usage:     "Generate a new page template and register its route",
+						UsageText: "napp generate page [command options] <page-name>",
+						Flags: []cli.Flag{
+							cli.BoolFlag{
+								Name:  "auth",
+								Usage: "only allow signed in users to view the page",
+							},
+						},
+						Action: pageAction,
+					},
+				},
+			},
+			{
+				Name:  "new",
+				Usage: "Add a new file to an existing napp project",
+				Subcommands: []cli.Command{
+					{
+						Name:      "page",
+						Usage:     "Add a page template that extends the layout and register its route",
+						UsageText: "napp new page [command options] <page-name>",
+						Flags: []cli.Flag{
+							cli.BoolFlag{
+								Name:  "auth",
+								Usage: "only allow signed in users to view the page",
+							},
+						},
+						Action: pageAction,
+					},
+				},
+			},
+			{
+				Name:      "completion",
+				Usage:     "Print a shell completion script for napp",
+				UsageText: "napp completion <bash|zsh|fish>",
+				BashComplete: func(cCtx *cli.Context) {
+					if cCtx.NArg() == 0 {
+						fmt.Fprintln(cCtx.App.Writer, strings.Join(completionShells, "\n"))
+					}
+				},
 				Action: func(cCtx *cli.Context) error {
 					if len(cCtx.Args()) != 1 {
 						msg := fmt.Sprintf(
 							"Oops! Received %v arguments, wanted 1",
 							len(cCtx.Args()),
 						)
-						return cli.NewExitError(msg, 1)
+						return cli.NewExitError(msg, exitInvalidArgs)
 					}
 
-					projectname := cCtx.Args().Get(0)
+					script, err := completionScript(cCtx.App, cCtx.Args().Get(0))
+					if err != nil {
+						return exitWith(err)
+					}
+
+					fmt.Print(script)
+
+					return nil
+				},
+			},
+		},
+		Author: "Damien Sedgwick",
+		Email:  "damienksedgwick@gmail.com",
+	}
+
+	app.OnUsageError = usageError
+	for i := range app.Commands {
+		app.Commands[i].OnUsageError = usageError
+		for j := range app.Commands[i].Subcommands {
+			app.Commands[i].Subcommands[j].OnUsageError = usageError
+		}
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+}
+
+// usageError is called when the flags can not be parsed, such as an unknown
+// flag or a number flag given a word, and exits with exitInvalidArgs.
+func usageError(cCtx *cli.Context, err error, isSubcommand bool) error {
+	help := "napp --help"
+	if name := cCtx.Command.FullName(); name != "" {
+		help = "napp " + name + " --help"
+	}
+
+	return exitWith(withExitCode(exitInvalidArgs, errors.New(err.Error()+", see "+help)))
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// bashCompletion and zshCompletion are the scripts urfave/cli ships, they
+// run napp with --generate-bash-completion for the words to offer, so new
+// commands and flags are picked up without regenerating them.
+const bashCompletion = `#!/bin/bash
+
+_napp_bash_autocomplete() {
+  if [[ "${COMP_WORDS[0]}" != "source" ]]; then
+    local cur opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    if [[ "$cur" == "-"* ]]; then
+      opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion )
+    else
+      opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion )
+    fi
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+  fi
+}
+
+complete -o bashdefault -o default -o nospace -F _napp_bash_autocomplete napp
+`
+
+const zshCompletion = `#compdef napp
+
+_napp_zsh_autocomplete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion)}")
+  else
+    opts=("${(@f)$(_CLI_ZSH_AUTOCOMPLETE_HACK=1 ${words[@]:0:#words[@]-1} --generate-bash-completion)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _napp_zsh_autocomplete napp
+`
+
+// completionScript returns the completion script for shell. fish does not
+// call back into napp, its script lists every command and flag up front.
+func completionScript(app *cli.App, shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	case "fish":
+		return app.ToFishCompletion()
+	}
+
+	return "", withExitCode(exitInvalidArgs, errors.New("shell must be one of the following: "+strings.Join(completionShells, ", ")))
+}
+
+// pageAction is shared by napp generate page and napp new page.
+func pageAction(cCtx *cli.Context) error {
+	if len(cCtx.Args()) != 1 {
+		msg := fmt.Sprintf(
+			"Oops! Received %v arguments, wanted 1",
+			len(cCtx.Args()),
+		)
+		return cli.NewExitError(msg, exitInvalidArgs)
+	}
+
+	pagename := cCtx.Args().Get(0)
+
+	if isInvalidPageName(pagename) {
+		return cli.NewExitError(
+			"Oops! Page name must be in the following format: <page-name>",
+			exitInvalidArgs,
+		)
+	}
+
+	if !isNappProject(".") {
+		return cli.NewExitError(
+			"Oops! This command must be run from the root of a napp project",
+			exitValidation,
+		)
+	}
+
+	err := generatePage(".", pagename, cCtx.Bool("auth"))
+	if err != nil {
+		return exitWith(err)
+	}
+
+	fmt.Println("Successfully generated " + pagename + ", next steps:")
+	if detectProjectOptions(".").templ {
+		fmt.Println("templ generate")
+	}
+	fmt.Println(runCommand("."))
+	fmt.Println("visit /" + pagename)
+
+	return nil
+}
+
+// Exit codes, so scripts can tell a typo in the command line from a project
+// that could not be written.
+const (
+	exitFailure     = 1
+	exitInvalidArgs = 2
+	exitFilesystem  = 3
+	exitValidation  = 4
+)
+
+// exitError carries the exit code napp should stop with alongside the error,
+// for failures deep inside createProject or generate that the command action
+// can not classify from the message alone.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+
+func (e *exitError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// exitWith turns an error from a command into the cli.ExitError it returns,
+// falling back to exitFilesystem for anything that failed on a path and
+// exitFailure for everything else.
+func exitWith(err error) error {
+	code := exitFailure
+
+	var ee *exitError
+	var pathErr *fs.PathError
+	if errors.As(err, &ee) {
+		code = ee.code
+	} else if errors.As(err, &pathErr) {
+		code = exitFilesystem
+	}
+
+	return cli.NewExitError("Oops! "+err.Error(), code)
+}
+
+// normaliseProjectName turns a project name into the kebab-case used for its
+// directory, env prefix and database file, so MyApp, my_app and my-app all
+// become my-app.
+func normaliseProjectName(name string) (string, error) {
+	matched, _ := regexp.MatchString("^[A-Za-z0-9_-]+$", name)
+	if !matched {
+		return "", errors.New("project name can only contain letters, numbers, dashes and underscores")
+	}
+
+	if strings.ContainsAny(name[:1], "-_") || strings.ContainsAny(name[len(name)-1:], "-_") {
+		return "", errors.New("project name can not start or end with a dash or underscore")
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+
+		// a capital starts a new word after a lower case letter or digit, and
+		// ends a run of capitals when a lower case letter follows, so
+		// MyAPIServer becomes my-api-server
+		if isUpper(ch) && i > 0 {
+			prev := name[i-1]
+			nextIsLower := i+1 < len(name) && name[i+1] >= 'a' && name[i+1] <= 'z'
+			if (!isUpper(prev) && prev != '-' && prev != '_') || (isUpper(prev) && nextIsLower) {
+				b.WriteByte('-')
+			}
+		}
+
+		if ch == '_' {
+			ch = '-'
+		}
+		b.WriteByte(ch)
+	}
+
+	normalised := strings.ToLower(b.String())
+	for strings.Contains(normalised, "--") {
+		normalised = strings.ReplaceAll(normalised, "--", "-")
+	}
+
+	return normalised, nil
+}
+
+func isUpper(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z'
+}
+
+// projectTitle is the display name for a project, my-app and my_app become
+// My App while MyApp keeps its own capitals.
+func projectTitle(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// promptProjectName asks for a project name until a valid one is entered.
+func promptProjectName(in io.Reader, out io.Writer) (string, error) {
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(out, "Project name: ")
+
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("no project name entered")
+		}
+
+		name := strings.TrimSpace(scanner.Text())
+		_, err := normaliseProjectName(name)
+		if err == nil {
+			return name, nil
+		}
+
+		fmt.Fprintln(out, strings.ToUpper(err.Error()[:1])+err.Error()[1:])
+	}
+}
+
+func isInvalidPageName(name string) bool {
+	pattern := "^[a-z0-9-]+$"
+
+	matched, err := regexp.MatchString(pattern, name)
+	if err != nil {
+		return true
+	}
+
+	return !matched
+}
+
+func isInvalidModelName(name string) bool {
+	pattern := "^[A-Za-z][A-Za-z0-9]*$"
+
+	matched, err := regexp.MatchString(pattern, name)
+	if err != nil {
+		return true
+	}
+
+	return !matched
+}
+
+type projectOptions struct {
+	css          string
+	git          bool
+	air          bool
+	embed        bool
+	minimal      bool
+	templ        bool
+	deploy       string
+	sessionStore string
+	htmxVersion  string
+	extras       []string
+	goVersion    string
+	db           string
+	migrations   bool
+	manifest     bool
+	worker       bool
+	avatars      bool
+	sse          bool
+	oauth        []string
+	description  string
+	readme       bool
+	license      string
+	author       string
+	header       bool
+	title        string
+	noDocker     bool
+	force        bool
+	dryRun       bool
+}
+
+// mainPackage is what go run and go build are pointed at, projects generated
+// with --embed keep main.go in the root so it can embed template and static.
+// templ projects compile the generated _templ.go files alongside main.go, and
+// projects with a database have store.go, and maybe worker.go, next to it, so
+// they need the whole package rather than just the file.
+func (opts projectOptions) mainPackage() string {
+	if opts.embed {
+		return "."
+	}
+	if opts.templ || !opts.minimal {
+		return "./cmd"
+	}
+
+	return "cmd/main.go"
+}
+
+// mainDir is the folder main.go and, with templ, the .templ files are in.
+func (opts projectOptions) mainDir(projectDir string) string {
+	if opts.embed {
+		return projectDir
+	}
+
+	return filepath.Join(projectDir, "cmd")
+}
+
+// displayTitle is the name shown in page titles and headings, taken from the
+// name the project was created with when there is one.
+func (opts projectOptions) displayTitle(projectDir string) string {
+	if opts.title != "" {
+		return opts.title
+	}
+
+	return projectTitle(filepath.Base(projectDir))
+}
+
+// metaDescription is the index page's meta description, the --description
+// when one was given. It is escaped for the attribute and so that braces can
+// not open a template action.
+func (opts projectOptions) metaDescription(title string) string {
+	description := opts.description
+	if description == "" {
+		description = title + ", built with Go and HTMX"
+	}
+
+	return strings.ReplaceAll(html.EscapeString(description), "{", "&#123;")
+}
+
+func isInvalidCss(css string) bool {
+	return css != "minimal" && css != "tailwind"
+}
+
+func isInvalidTemplateEngine(engine string) bool {
+	return engine != "html" && engine != "templ"
+}
+
+func isInvalidDb(db string) bool {
+	return db != "sqlite" && db != "mysql"
+}
+
+func isInvalidSessionStore(sessionStore string) bool {
+	return sessionStore != "cookie" && sessionStore != "db"
+}
+
+func isInvalidDeploy(deploy string) bool {
+	switch deploy {
+	case "", "fly", "render", "railway", "dokku":
+		return false
+	}
+
+	return true
+}
+
+// oauthLabels are the providers --oauth accepts, by the name they are
+// given on the command line.
+var oauthLabels = map[string]string{
+	"github": "GitHub",
+	"google": "Google",
+}
+
+func isInvalidOAuth(providers []string) bool {
+	seen := map[string]bool{}
+	for _, provider := range providers {
+		if _, ok := oauthLabels[provider]; !ok || seen[provider] {
+			return true
+		}
+		seen[provider] = true
+	}
+
+	return false
+}
+
+// splitList turns a comma separated flag value into its trimmed, non-empty
+// parts.
+func splitList(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+func isInvalidLicense(license string) bool {
+	switch license {
+	case "", "MIT", "Apache-2.0", "BSD-3-Clause":
+		return false
+	}
+
+	return true
+}
+
+// sourceTemplateFields are the fields napp fills in for each embedded file
+// that has [[ ]] placeholders. They are checked before anything is written,
+// so a source file that uses a field napp does not pass stops napp instead of
+// leaving a half generated project.
+var sourceTemplateFields = map[string][]string{
+	"source/.env":                            {"DatabaseConfig", "SessionEnv", "SessionSecret", "SessionStore"},
+	"source/.gitignore":                      {"EnvFile", "DatabaseFile", "NodeModules", "UploadsDir", "BackupsDir"},
+	"source/Dockerfile":                      {"GoVersion", "MainPackage", "CopyAssets"},
+	"source/Makefile":                        {"Name", "MainPackage"},
+	"source/README.md":                       {"Title", "Description", "RunCommands", "EnvVars", "DeployNotes"},
+	"source/air/.air.toml":                   {"MainPackage"},
+	"source/avatar/account-avatar.html":      {"Title"},
+	"source/cmd/main.go":                     {"SessionEnv", "DatabaseEnv", "Title"},
+	"source/db/mysql.env":                    {"DatabaseName"},
+	"source/deploy/app.json":                 {"Name", "EnvPrefix", "VolumeName"},
+	"source/deploy/fly.toml":                 {"Name", "EnvPrefix", "VolumeName"},
+	"source/deploy/railway.json":             {"Name", "EnvPrefix", "VolumeName"},
+	"source/deploy/render.yaml":              {"Name", "EnvPrefix", "VolumeName"},
+	"source/generate/page.html":              {"Name", "Title"},
+	"source/generate/standalone-page.html":   {"Name", "Title"},
+	"source/gomod/minimal/go.mod.tmpl":       {"Name", "GoVersion"},
+	"source/gomod/minimal-templ/go.mod.tmpl": {"Name", "GoVersion"},
+	"source/gomod/mysql/go.mod.tmpl":         {"Name", "GoVersion"},
+	"source/gomod/mysql-oauth/go.mod.tmpl":   {"Name", "GoVersion"},
+	"source/gomod/sqlite/go.mod.tmpl":        {"Name", "GoVersion"},
+	"source/gomod/sqlite-oauth/go.mod.tmpl":  {"Name", "GoVersion"},
+	"source/minimal/template/index.html":     {"MetaDescription", "Title"},
+	"source/minimal/template/layout.html":    {"Title"},
+	"source/minimal/test/main_test.go.tmpl":  {"AssetsDir"},
+	"source/static/manifest.webmanifest":     {"JSONTitle"},
+	"source/tailwind/package.json":           {"Name"},
+	"source/template/account.html":           {"Title"},
+	"source/template/admin-events.html":      {"Title"},
+	"source/template/admin-users.html":       {"Title"},
+	"source/template/admin.html":             {"Title"},
+	"source/template/dashboard.html":         {"Title"},
+	"source/template/error.html":             {"Title"},
+	"source/template/index.html":             {"MetaDescription", "Title"},
+	"source/template/layout.html":            {"Title"},
+	"source/template/verify.html":            {"Title"},
+	"source/templ/error.templ":               {"Title", "QuotedTitle", "QuotedTitleSuffix", "MetaDescription", "IndexPath"},
+	"source/templ/index.templ":               {"Title", "QuotedTitle", "QuotedTitleSuffix", "MetaDescription", "IndexPath"},
+	"source/templ/layout.templ":              {"Title", "QuotedTitle", "QuotedTitleSuffix", "MetaDescription", "IndexPath"},
+	"source/templ/page.templ":                {"Component", "QuotedTitle", "Title"},
+	"source/test/main_test.go.tmpl":          {"AssetsDir"},
+}
+
+// checkSourceTemplates fills in each embedded file with stand in values for
+// its fields, reporting every file that fails to parse or uses a field napp
+// does not pass.
+func checkSourceTemplates() error {
+	var broken []string
+	for name, fields := range sourceTemplateFields {
+		data := map[string]string{}
+		for _, field := range fields {
+			data[field] = field
+		}
+
+		if _, err := executeSourceTemplate(name, data); err != nil {
+			broken = append(broken, err.Error())
+		}
+	}
+
+	if len(broken) > 0 {
+		sort.Strings(broken)
+		return withExitCode(exitValidation, errors.New("embedded source files do not match napp:\n"+strings.Join(broken, "\n")))
+	}
+
+	return nil
+}
+
+func createProject(projectDir string, opts projectOptions) (bool, error) {
+	if err := checkSourceTemplates(); err != nil {
+		return false, err
+	}
+
+	// a dry run has already checked where the project would really go
+	if !opts.dryRun {
+		if err := checkProjectLocation(projectDir, opts); err != nil {
+			return false, err
+		}
+	}
+
+	if err := checkStaticExtras(opts.extras); err != nil {
+		return false, err
+	}
+
+	err := os.MkdirAll(filepath.Dir(projectDir), 0755)
+	if err != nil {
+		return false, fmt.Errorf("error creating parent directory: %w", err)
+	}
+
+	err = os.Mkdir(projectDir, 0755)
+	if err != nil {
+		return false, fmt.Errorf("error creating project directory: %w", err)
+	}
+
+	subfolders := []string{"static"}
+	if !opts.templ {
+		subfolders = append(subfolders, "template")
+	}
+	if !opts.embed {
+		subfolders = append(subfolders, "cmd")
+	}
+	if opts.migrations {
+		subfolders = append(subfolders, "migrations")
+	}
+	if !opts.minimal {
+		subfolders = append(subfolders, "locales")
+	}
+	for _, folder := range subfolders {
+		folderPath := filepath.Join(projectDir, folder)
+
+		err := os.Mkdir(folderPath, 0755)
+		if err != nil {
+			return false, fmt.Errorf("error creating subfolder %s: %w", folder, err)
+		}
+	}
+
+	createGoModFiles(projectDir, opts)
+	createGoMainFile(projectDir, opts)
+	if opts.embed {
+		createEmbedFile(projectDir, opts)
+	}
+	if opts.migrations {
+		createInitialMigrationFile(projectDir, opts)
+	}
+	if !opts.minimal {
+		createStoreFile(projectDir, opts)
+	}
+	if opts.worker {
+		createWorkerFile(projectDir, opts)
+	}
+	createGoTestFile(projectDir, opts)
+	if err := createExtraFiles(projectDir, opts.extras); err != nil {
+		return false, err
+	}
+	if opts.templ {
+		createTemplFiles(projectDir, opts)
+	} else {
+		createLayoutHtmlFile(projectDir, opts)
+		createHtmlFile(projectDir, opts)
+		createErrorHtmlFile(projectDir, opts)
+	}
+	if !opts.minimal {
+		createDashboardHtmlFile(projectDir, opts)
+		createAdminHtmlFile(projectDir, opts)
+		createAdminEventsHtmlFile(projectDir, opts)
+		createAdminUsersHtmlFile(projectDir, opts)
+		createAccountHtmlFile(projectDir, opts)
+		createVerifyHtmlFile(projectDir, opts)
+		createLocaleFile(projectDir, opts)
+	}
+	if opts.avatars {
+		createAccountAvatarHtmlFile(projectDir, opts)
+	}
+	if opts.sse {
+		createSSEFiles(projectDir)
+	}
+	if opts.dryRun {
+		// the plan lists htmx.min.js without downloading --htmx-version
+		createHtmxFile(projectDir, "")
+	} else {
+		createHtmxFile(projectDir, opts.htmxVersion)
+	}
+	createTwColorsFile(projectDir)
+	createCssFile(projectDir)
+	createFaviconFiles(projectDir)
+	if opts.manifest {
+		createManifestFile(projectDir, opts)
+	}
+	if opts.css == "tailwind" {
+		createTailwindConfigFile(projectDir)
+		createTailwindInputFile(projectDir)
+		createPackageJsonFile(projectDir)
+	}
+	createIgnoreFile(projectDir, opts)
+	createDotEnvFile(projectDir, opts)
+	if !opts.minimal && opts.db == "sqlite" {
+		createSqliteDbFile(projectDir)
+	}
+	if !opts.noDocker {
+		createDockerfile(projectDir, opts)
+		createDockerIgnoreFile(projectDir)
+	}
+	createMakefile(projectDir, opts)
+	if opts.air {
+		createAirConfigFile(projectDir, opts)
+	}
+	if opts.deploy != "" {
+		createDeployFile(projectDir, opts.deploy)
+	}
+	if opts.readme {
+		createReadmeFile(projectDir, opts)
+	}
+	createConfigFile(projectDir, opts)
+	if opts.license != "" {
+		createLicenseFile(projectDir, opts)
+		if opts.header {
+			addLicenseHeaders(projectDir, opts)
+		}
+	}
+
+	if opts.git {
+		initGitRepo(projectDir)
+	}
+
+	return true, nil
+}
+
+// findEnclosing returns the path of name in dir or the closest directory
+// above it that has one, or nothing when there is none up to the root.
+func findEnclosing(dir string, name string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkProjectLocation stops a project being created inside another Go
+// module unless opts.force is set. The outer module's go build ./... and
+// go test ./... skip the nested one, and editors and go run from the wrong
+// directory pick up the outer go.mod, which is rarely what was meant.
+func checkProjectLocation(projectDir string, opts projectOptions) error {
+	parent := filepath.Dir(projectDir)
+
+	if goMod := findEnclosing(parent, "go.mod"); goMod != "" {
+		if !opts.force {
+			return withExitCode(exitValidation, fmt.Errorf(
+				"%s would be inside the Go module at %s, nested modules confuse go build and editors, pass --force to create it anyway",
+				projectDir, goMod,
+			))
+		}
+
+		fmt.Println("warning: " + projectDir + " is inside the Go module at " + goMod)
+	}
+
+	if opts.git {
+		if repo := findEnclosing(parent, ".git"); repo != "" {
+			fmt.Println("warning: " + projectDir + " is inside the git repository at " + filepath.Dir(repo) + ", --git will nest a second repository in it")
+		}
+	}
+
+	return nil
+}
+
+// printProjectPlan shows what createProject would write for projectDir. The
+// project is generated into a scratch directory, like upgrade does, and
+// listed from there, so the plan is exactly what init produces and nothing is
+// left behind.
+func printProjectPlan(w io.Writer, projectDir string, opts projectOptions) error {
+	if _, err := os.Stat(projectDir); err == nil {
+		return withExitCode(exitFilesystem, fmt.Errorf("%s already exists", projectDir))
+	}
+
+	if err := checkProjectLocation(projectDir, opts); err != nil {
+		return err
+	}
+
+	scratch, err := os.MkdirTemp("", "napp-dry-run")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	// files such as .env and the Makefile are named after the project, so
+	// the scratch copy has the same name
+	stageDir := filepath.Join(scratch, filepath.Base(projectDir))
+	git := opts.git
+	opts.git = false
+	opts.dryRun = true
+
+	_, err = createProject(stageDir, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "napp init would create "+projectDir+" with:")
+	fmt.Fprintln(w, "title: "+opts.displayTitle(stageDir))
+
+	env, err := godotenv.Read(filepath.Join(stageDir, ".env"))
+	if err != nil {
+		return fmt.Errorf("error reading the planned .env: %w", err)
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(w, ".env settings: "+strings.Join(keys, ", "))
+
+	fmt.Fprintln(w, "files:")
+	err = filepath.WalkDir(stageDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == stageDir {
+			return err
+		}
+
+		rel, err := filepath.Rel(stageDir, path)
+		if err != nil {
+			return err
+		}
+
+		indent := strings.Repeat("  ", strings.Count(filepath.ToSlash(rel), "/")+1)
+		if d.IsDir() {
+			fmt.Fprintln(w, indent+d.Name()+"/")
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, indent+d.Name()+" ("+formatSize(info.Size())+")")
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.htmxVersion != "" && opts.htmxVersion != bundledHtmxVersion {
+		fmt.Fprintln(w, "static/htmx.min.js is listed at the size of the bundled "+bundledHtmxVersion+", init downloads "+opts.htmxVersion+" in its place")
+	}
+
+	if git {
+		fmt.Fprintln(w, "then git init and an initial commit of every file")
+	}
+
+	return nil
+}
+
+func envPrefix(projectName string) string {
+	return strings.ReplaceAll(strings.ToUpper(projectName), "-", "_")
+}
+
+func createGoMainFile(projectDir string, opts projectOptions) {
+	projectName := filepath.Base(projectDir)
+
+	sessEnv := envPrefix(projectName) + "_COOKIE_STORE_SECRET"
+	dbEnv := envPrefix(projectName) + "_DB_PATH"
+
+	title := opts.displayTitle(projectDir)
+
+	var mainGoContent string
+	if opts.minimal {
+		minimalGoContent, err := source.ReadFile("source/minimal/cmd/main.go")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source minimal main.go file: %w", err))
+		}
+
+		mainGoContent = string(minimalGoContent)
+
+		if opts.templ {
+			mainGoContent, err = useTempl(mainGoContent)
+			if err != nil {
+				fmt.Println("error switching main.go to templ: ", err)
+			}
+		}
+	} else {
+		var err error
+		mainGoContent, err = executeSourceTemplate("source/cmd/main.go", map[string]string{
+			"SessionEnv":  sessEnv,
+			"DatabaseEnv": dbEnv,
+			"Title":       title,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		if opts.db == "mysql" {
+			mainGoContent, err = useMySQL(mainGoContent, dbEnv)
+			if err != nil {
+				fmt.Println("error switching main.go to mysql: ", err)
+			}
+		}
+
+		if opts.migrations {
+			mainGoContent, err = useMigrations(mainGoContent)
+			if err != nil {
+				fmt.Println("error switching main.go to migrations: ", err)
+			}
+		}
+
+		if len(opts.oauth) > 0 {
+			mainGoContent, err = useOAuth(mainGoContent, opts.oauth)
+			if err != nil {
+				fmt.Println("error adding oauth to main.go: ", err)
+			}
+		}
+
+		if opts.avatars {
+			mainGoContent, err = useAvatars(mainGoContent)
+			if err != nil {
+				fmt.Println("error adding avatars to main.go: ", err)
+			}
+		}
+
+		if opts.worker {
+			jobs := "\tif useDBSessions {\n\t\tjobs.every(expiredSessionCleanupInterval, \"expired session cleanup\", cleanupExpiredSessions(db))\n\t}\n"
+			if !strings.Contains(mainGoContent, jobs) {
+				fmt.Println("error adding worker jobs to main.go: could not find the scheduled jobs")
+			}
+			mainGoContent = strings.Replace(mainGoContent, jobs, jobs+"\tregisterJobs(jobs, db)\n", 1)
+		}
+	}
+
+	if opts.sse {
+		var err error
+		mainGoContent, err = useSSE(mainGoContent)
+		if err != nil {
+			fmt.Println("error adding server-sent events to main.go: ", err)
+		}
+	}
+
+	if opts.description != "" {
+		mainGoContent = "// " + title + ": " + opts.description + "\n" + mainGoContent
+	}
+
+	filePath := filepath.Join(projectDir, "cmd", "main.go")
+	if opts.embed {
+		filePath = filepath.Join(projectDir, "main.go")
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating main.go file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(mainGoContent)
+	if err != nil {
+		fmt.Println("error writing main.go content to file: ", err)
+	}
+}
+
+// useMySQL swaps the SQLite driver, the call that opens it and its DSN helper
+// in the generated main.go for their MySQL equivalents, dropping the now
+// unused database path setting.
+func useMySQL(mainGoContent string, dbEnv string) (string, error) {
+	dsnTemplate, err := source.ReadFile("source/db/mysql.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source mysql.go.tmpl file: %w", err)
+	}
+
+	start := strings.Index(mainGoContent, "// databaseDSN")
+	if start < 0 {
+		return mainGoContent, errors.New("could not find databaseDSN")
+	}
+	end := start + strings.Index(mainGoContent[start:], "\n}\n") + len("\n}\n")
+	mainGoContent = mainGoContent[:start] + string(dsnTemplate) + mainGoContent[end:]
+
+	// VACUUM INTO is SQLite only, MySQL has mysqldump for backups
+	start = strings.Index(mainGoContent, "const backupTimeLayout")
+	backupEnd := strings.Index(mainGoContent, "func backupDatabase(")
+	if start < 0 || backupEnd < start {
+		return mainGoContent, errors.New("could not find backupDatabase")
+	}
+	end = backupEnd + strings.Index(mainGoContent[backupEnd:], "\n}\n") + len("\n}\n\n")
+	mainGoContent = mainGoContent[:start] + mainGoContent[end:]
+
+	start = strings.Index(mainGoContent, "\tif len(os.Args) > 1 && os.Args[1] == \"backup\" {")
+	if start < 0 {
+		return mainGoContent, errors.New("could not find the backup command")
+	}
+	end = start + strings.Index(mainGoContent[start:], "\n\t}\n") + len("\n\t}\n\n")
+	mainGoContent = mainGoContent[:start] + mainGoContent[end:]
+
+	replacements := [][2]string{
+		{`"gorm.io/driver/sqlite"`, `"gorm.io/driver/mysql"`},
+		{"\te.GET(\"/admin/backup\", backupHandler(db), requireRole(\"admin\"))\n", ""},
+		{`sqlite.Open(cfg.DatabaseDSN)`, `mysql.New(mysql.Config{DSN: cfg.DatabaseDSN, DefaultStringSize: 191})`},
+		{"\n\tdatabasePathEnv  = \"" + dbEnv + "\"", ""},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	return mainGoContent, nil
+}
+
+// useTempl swaps the html/template renderer in the generated minimal main.go
+// for a render helper that writes templ components, and points the handlers
+// at the components in the generated .templ files.
+func useTempl(mainGoContent string) (string, error) {
+	renderTemplate, err := source.ReadFile("source/templ/render.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source render.go.tmpl file: %w", err)
+	}
+
+	start := strings.Index(mainGoContent, "// Template renders the pages")
+	end := strings.Index(mainGoContent, "func main() {")
+	if start < 0 || end < start {
+		return mainGoContent, errors.New("could not find the Template renderer")
+	}
+	mainGoContent = mainGoContent[:start] + string(renderTemplate) + mainGoContent[end:]
+
+	replacements := [][2]string{
+		{"\t\"html/template\"\n", ""},
+		{"\t\"io\"\n", ""},
+		{"\t\"github.com/joho/godotenv\"\n", "\t\"github.com/a-h/templ\"\n\t\"github.com/joho/godotenv\"\n"},
+		{"log.Fatal(\"error loading templates: \", err)", "log.Fatal(\"error loading static files: \", err)"},
+		{"\trenderer, err := newTemplate(assets, cfg.ReloadTemplates)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\te.Renderer = renderer\n",
+			"\tversions, err := assetVersions(assets)\n\tif err != nil {\n\t\treturn nil, errors.New(\"hashing static files: \" + err.Error())\n\t}\n\tstaticVersions = versions\n"},
+		{"pageHandler(\"index\")", "pageHandler(indexPage())"},
+		{"\tReloadTemplates   bool\n", ""},
+		{"\treload, err := boolEnv(\"RELOAD_TEMPLATES\", cfg.AppEnv == \"development\")\n\tif err != nil {\n\t\treturn cfg, err\n\t}\n\tcfg.ReloadTemplates = reload\n\n", ""},
+		{"// ErrorData is passed to error.html.", "// ErrorData is passed to errorPage."},
+		{"gets error.html with the", "gets errorPage with the"},
+		{"err = c.Render(status, \"error\", ErrorData{", "err = render(c, status, errorPage(ErrorData{"},
+		{"\t\t\tMessage: message,\n\t\t})\n", "\t\t\tMessage: message,\n\t\t}))\n"},
+		{"func pageHandler(name string) echo.HandlerFunc {\n\treturn func(c echo.Context) error {\n\t\treturn c.Render(200, name, nil)",
+			"func pageHandler(page templ.Component) echo.HandlerFunc {\n\treturn func(c echo.Context) error {\n\t\treturn render(c, 200, page)"},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	formatted, err := format.Source([]byte(mainGoContent))
+	if err != nil {
+		return mainGoContent, err
+	}
+
+	return string(formatted), nil
+}
+
+// createStoreFile writes store.go next to main.go, with the Store interface
+// the handlers query the database through.
+func createStoreFile(projectDir string, opts projectOptions) {
+	storeGoContent, err := source.ReadFile("source/cmd/store.go")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source store.go file: %w", err))
+	}
+
+	filePath := filepath.Join(opts.mainDir(projectDir), "store.go")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating store.go file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(storeGoContent)
+	if err != nil {
+		fmt.Println("error writing store.go content to file: ", err)
+	}
+}
+
+// createWorkerFile writes worker.go next to main.go, with an example job that
+// prunes old auth events.
+func createWorkerFile(projectDir string, opts projectOptions) {
+	workerGoContent, err := source.ReadFile("source/worker/worker.go.tmpl")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source worker.go.tmpl file: %w", err))
+	}
+
+	filePath := filepath.Join(opts.mainDir(projectDir), "worker.go")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating worker.go file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(workerGoContent)
+	if err != nil {
+		fmt.Println("error writing worker.go content to file: ", err)
+	}
+}
+
+// createTemplFiles writes the layout, home and error page components next to
+// main.go, they are turned into Go by templ generate.
+func createTemplFiles(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	indexPath, err := filepath.Rel(projectDir, filepath.Join(opts.mainDir(projectDir), "index.templ"))
+	if err != nil {
+		fmt.Println("error finding index.templ path: ", err)
+	}
+
+	data := map[string]string{
+		"Title":             title,
+		"QuotedTitle":       strconv.Quote(title),
+		"QuotedTitleSuffix": strconv.Quote(" | " + title),
+		"MetaDescription":   opts.metaDescription(title),
+		"IndexPath":         filepath.ToSlash(indexPath),
+	}
+
+	for _, name := range []string{"layout.templ", "index.templ", "error.templ"} {
+		templContent, err := executeSourceTemplate("source/templ/"+name, data)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		if name == "layout.templ" && opts.manifest {
+			iconLink := "\t\t\t<link rel=\"icon\" href={ asset(\"favicon.svg\") } type=\"image/svg+xml\"/>\n"
+			manifestLink := "\t\t\t<link rel=\"manifest\" href={ asset(\"manifest.webmanifest\") }/>\n"
+			templContent = strings.Replace(templContent, iconLink, iconLink+manifestLink, 1)
+		}
+		if name == "layout.templ" {
+			var scripts string
+			for _, extra := range opts.staticExtras() {
+				scripts += "\t\t\t<script src={ asset(\"" + extra.file + "\") } defer></script>\n"
+			}
+			templContent = strings.Replace(templContent, "\t\t</head>\n", scripts+"\t\t</head>\n", 1)
+		}
+
+		f, err := os.Create(filepath.Join(opts.mainDir(projectDir), name))
+		if err != nil {
+			fmt.Println("error creating "+name+" file: ", err)
+			continue
+		}
+
+		_, err = f.WriteString(templContent)
+		if err != nil {
+			fmt.Println("error writing "+name+" content to file: ", err)
+		}
+		f.Close()
+	}
+}
+
+// useMigrations swaps the AutoMigrate based migrate in the generated main.go
+// for one that applies the SQL files in migrations/, dropping the model list
+// it no longer needs.
+func useMigrations(mainGoContent string) (string, error) {
+	migrateTemplate, err := source.ReadFile("source/migrations/migrate.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source migrate.go.tmpl file: %w", err)
+	}
+
+	start := strings.Index(mainGoContent, "// migrate runs AutoMigrate")
+	if start < 0 {
+		return mainGoContent, errors.New("could not find migrate")
+	}
+	end := start + strings.Index(mainGoContent[start:], "\n}\n") + len("\n}\n")
+	mainGoContent = mainGoContent[:start] + string(migrateTemplate) + mainGoContent[end:]
+
+	replacements := [][2]string{
+		{"\tmodels := []interface{}{\n\t\t&Lead{},\n\t\t&User{},\n\t\t&AuthEvent{},\n\t\t" + modelsMarker + "\n\t}\n\n", ""},
+		{"\t\tmodels = append(models, &Session{})\n", ""},
+		{"migrate(db, migrationTimeout, models...)", "migrate(db, migrationTimeout, assets)"},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	return mainGoContent, nil
+}
+
+// oauthUserFields are the columns that link a user to each provider, they
+// are pointers so users without one all store NULL under the unique index.
+var oauthUserFields = map[string]string{
+	"github": "\tGitHubID *string `gorm:\"column:github_id;uniqueIndex\"`\n",
+	"google": "\tGoogleID *string `gorm:\"uniqueIndex\"`\n",
+}
+
+// useOAuth adds the sign in with provider handlers to the generated main.go,
+// along with the config, routes and user columns they need.
+func useOAuth(mainGoContent string, providers []string) (string, error) {
+	oauthTemplate, err := source.ReadFile("source/oauth/oauth.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source oauth.go.tmpl file: %w", err)
+	}
+
+	var providerList, userFields string
+	for _, provider := range providers {
+		providerList += "\t" + provider + "OAuth,\n"
+		userFields += oauthUserFields[provider]
+	}
+
+	replacements := [][2]string{
+		{"\t\"golang.org/x/crypto/bcrypt\"\n", "\t\"golang.org/x/crypto/bcrypt\"\n\t\"golang.org/x/oauth2\"\n\t\"golang.org/x/oauth2/endpoints\"\n"},
+		{"\tMail               MailConfig\n}", "\tMail               MailConfig\n\tOAuthProviders     map[string]oauthProvider\n}"},
+		{"\treturn cfg, errors.Join(errs...)", "\tproviders, err := loadOAuthProviders(cfg.AppURL)\n\tif err != nil {\n\t\terrs = append(errs, err)\n\t}\n\tcfg.OAuthProviders = providers\n\n\treturn cfg, errors.Join(errs...)"},
+		{"\tVerificationToken string `gorm:\"index\" json:\"-\"`\n}", "\tVerificationToken string `gorm:\"index\" json:\"-\"`\n" + userFields + "}"},
+		{"\te.GET(\"/healthz\"", "\te.GET(\"/auth/oauth/:provider\", oauthStartHandler(cfg.OAuthProviders))\n\te.GET(\"/auth/oauth/:provider/callback\", oauthCallbackHandler(data, cfg.OAuthProviders), authLimiter)\n\te.GET(\"/healthz\""},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	mainGoContent += strings.Replace(string(oauthTemplate), "\t// napp:oauth-providers\n", providerList, 1)
+
+	for _, provider := range providers {
+		providerTemplate, err := source.ReadFile("source/oauth/" + provider + ".go.tmpl")
+		if err != nil {
+			return mainGoContent, fmt.Errorf("error reading source %s.go.tmpl file: %w", provider, err)
+		}
+
+		mainGoContent += string(providerTemplate)
+	}
+
+	formatted, err := format.Source([]byte(mainGoContent))
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error formatting main.go: %w", err)
+	}
+
+	return string(formatted), nil
+}
+
+// useAvatars adds the avatar upload handlers to main.go, with an AvatarPath on
+// User and the uploads served from UPLOADS_DIR.
+func useAvatars(mainGoContent string) (string, error) {
+	avatarTemplate, err := source.ReadFile("source/avatar/avatar.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source avatar.go.tmpl file: %w", err)
+	}
+
+	replacements := [][2]string{
+		{"\t\"path\"\n", "\t\"path\"\n\t\"path/filepath\"\n"},
+		{"\tMail               MailConfig\n", "\tMail               MailConfig\n\tUploadsDir         string\n"},
+		{"\t\tSeedAdminPassword:  envOr(\"SEED_ADMIN_PASSWORD\", defaultSeedAdminPassword),\n", "\t\tSeedAdminPassword:  envOr(\"SEED_ADMIN_PASSWORD\", defaultSeedAdminPassword),\n\t\tUploadsDir:         envOr(\"UPLOADS_DIR\", \"uploads\"),\n"},
+		{"\tEmailVerified     bool\n", "\tEmailVerified     bool\n\tAvatarPath        string\n"},
+		{"\te.GET(\"/healthz\"", "\te.GET(\"/account/avatar\", accountAvatarHandler(db), requireAuth)\n\te.POST(\"/account/avatar\", uploadAvatarHandler(db, cfg.UploadsDir), requireAuth)\n\t// avatars are written while the app runs, so they are served from disk\n\t// even when static is embedded\n\te.GET(\"/uploads/*\", echo.StaticDirectoryHandler(os.DirFS(cfg.UploadsDir), false))\n\te.GET(\"/healthz\""},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	mainGoContent += string(avatarTemplate)
+
+	formatted, err := format.Source([]byte(mainGoContent))
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error formatting main.go: %w", err)
+	}
+
+	return string(formatted), nil
+}
+
+// useSSE adds the /events stream from source/sse to main.go. It works the
+// same for minimal projects, which have the routes marker and skipGzip too.
+func useSSE(mainGoContent string) (string, error) {
+	sseTemplate, err := source.ReadFile("source/sse/sse.go.tmpl")
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error reading source sse.go.tmpl file: %w", err)
+	}
+
+	replacements := [][2]string{
+		{"func skipGzip(c echo.Context) bool {\n", "func skipGzip(c echo.Context) bool {\n\t// event streams are flushed an event at a time, which gzip would hold\n\t// back\n\tif c.Request().URL.Path == \"/events\" {\n\t\treturn true\n\t}\n\n"},
+		{"\t// napp:routes\n", "\t// open event streams would hold up shutdown until it timed out, so\n\t// they are ended as soon as it starts. echo shuts its TLS server down\n\t// first, whether or not DOMAIN started it, so the streams end there.\n\tstreamsDone := make(chan struct{})\n\te.TLSServer.RegisterOnShutdown(func() { close(streamsDone) })\n\te.GET(\"/events\", eventsHandler(streamsDone))\n\t// napp:routes\n"},
+	}
+	for _, r := range replacements {
+		if !strings.Contains(mainGoContent, r[0]) {
+			return mainGoContent, fmt.Errorf("could not find %s", r[0])
+		}
+		mainGoContent = strings.Replace(mainGoContent, r[0], r[1], 1)
+	}
+
+	mainGoContent += string(sseTemplate)
+
+	formatted, err := format.Source([]byte(mainGoContent))
+	if err != nil {
+		return mainGoContent, fmt.Errorf("error formatting main.go: %w", err)
+	}
+
+	return string(formatted), nil
+}
+
+// createSSEFiles writes the htmx sse extension and the live-update partial
+// eventsHandler renders.
+func createSSEFiles(projectDir string) {
+	files := [][2]string{
+		{"source/sse/sse.js", filepath.Join(projectDir, "static", "sse.js")},
+		{"source/sse/live-update.html", filepath.Join(projectDir, "template", "components", "live-update.html")},
+	}
+
+	for _, file := range files {
+		content, err := source.ReadFile(file[0])
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source %s file: %w", filepath.Base(file[0]), err))
+			continue
+		}
+
+		err = os.MkdirAll(filepath.Dir(file[1]), 0755)
+		if err != nil {
+			fmt.Println("error creating "+filepath.Dir(file[1])+" folder: ", err)
+			continue
+		}
+
+		err = os.WriteFile(file[1], content, 0644)
+		if err != nil {
+			fmt.Println("error writing "+filepath.Base(file[0])+" content to file: ", err)
+		}
+	}
+}
+
+func createGoTestFile(projectDir string, opts projectOptions) {
+	testSource := "source/test/main_test.go.tmpl"
+	if opts.minimal {
+		testSource = "source/minimal/test/main_test.go.tmpl"
+	}
+
+	assetsDir := ".."
+	filePath := filepath.Join(projectDir, "cmd", "main_test.go")
+	if opts.embed {
+		assetsDir = "."
+		filePath = filepath.Join(projectDir, "main_test.go")
+	}
+
+	mainTestContent, err := executeSourceTemplate(testSource, map[string]string{
+		"AssetsDir": assetsDir,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if opts.db == "mysql" {
+		start := strings.Index(mainTestContent, "\nfunc TestAdminBackup(")
+		if start >= 0 {
+			end := start + strings.Index(mainTestContent[start:], "\n}\n") + len("\n}\n")
+			mainTestContent = mainTestContent[:start] + mainTestContent[end:]
+		}
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating main_test.go file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(mainTestContent)
+	if err != nil {
+		fmt.Println("error writing main_test.go content to file: ", err)
+	}
+}
+
+func createEmbedFile(projectDir string, opts projectOptions) {
+	embedGoContent, err := source.ReadFile("source/embed/embed.go.tmpl")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source embed.go file: %w", err))
+	}
+
+	if !opts.minimal {
+		embedGoContent = bytes.Replace(embedGoContent, []byte("//go:embed template static"), []byte("//go:embed template static locales"), 1)
+	}
+	if opts.migrations {
+		embedGoContent = bytes.Replace(embedGoContent, []byte("//go:embed template static"), []byte("//go:embed template static migrations"), 1)
+	}
+	if opts.templ {
+		embedGoContent = bytes.Replace(embedGoContent, []byte("//go:embed template static"), []byte("//go:embed static"), 1)
+	}
+
+	filePath := filepath.Join(projectDir, "embed.go")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating embed.go file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(embedGoContent))
+	if err != nil {
+		fmt.Println("error writing embed.go content to file: ", err)
+	}
+}
+
+func createLayoutHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	layoutSource := "source/template/layout.html"
+	if opts.minimal {
+		layoutSource = "source/minimal/template/layout.html"
+	}
+
+	layoutHTMLContent, err := executeSourceTemplate(layoutSource, map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if opts.manifest {
+		iconLink := `  <link rel="icon" href="{{ asset "favicon.svg" }}" type="image/svg+xml">` + "\n"
+		manifestLink := `  <link rel="manifest" href="{{ asset "manifest.webmanifest" }}">` + "\n"
+		layoutHTMLContent = strings.Replace(layoutHTMLContent, iconLink, iconLink+manifestLink, 1)
+	}
+	if opts.sse {
+		// deferred scripts run in order, so the extension finds htmx loaded
+		htmxScript := `  <script src="{{ asset "htmx.min.js" }}" defer></script>` + "\n"
+		sseScript := `  <script src="{{ asset "sse.js" }}" defer></script>` + "\n"
+		layoutHTMLContent = strings.Replace(layoutHTMLContent, htmxScript, htmxScript+sseScript, 1)
+	}
+	var extraScripts string
+	for _, extra := range opts.staticExtras() {
+		extraScripts += `  <script src="{{ asset "` + extra.file + `" }}" defer></script>` + "\n"
+	}
+	layoutHTMLContent = strings.Replace(layoutHTMLContent, "</head>\n", extraScripts+"</head>\n", 1)
+
+	filePath := filepath.Join(projectDir, "template", "layout.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating layout.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(layoutHTMLContent)
+	if err != nil {
+		fmt.Println("error writing layout.html content to file: ", err)
+	}
+}
+
+func createHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	var indexHTMLContent string
+	if opts.minimal {
+		var err error
+		indexHTMLContent, err = executeSourceTemplate("source/minimal/template/index.html", map[string]string{
+			"MetaDescription": opts.metaDescription(title),
+			"Title":           title,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+	} else {
+		var err error
+		indexHTMLContent, err = executeSourceTemplate("source/template/index.html", map[string]string{
+			"MetaDescription": opts.metaDescription(title),
+			"Title":           title,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		var oauthLinks string
+		for _, provider := range opts.oauth {
+			oauthLinks += "\n    <a class=\"btn auth-form__btn auth-form__oauth\" href=\"/auth/oauth/" + provider + "\">Continue with " + oauthLabels[provider] + "</a>\n"
+		}
+		for _, button := range []string{"Register", "Sign In"} {
+			submit := "<button class=\"btn auth-form__btn\" type=\"submit\">" + button + "</button>\n"
+			indexHTMLContent = strings.Replace(indexHTMLContent, submit, submit+oauthLinks, 1)
+		}
+	}
+
+	if opts.sse {
+		liveUpdate := "      <div class=\"live-update\" hx-ext=\"sse\" sse-connect=\"/events\" sse-swap=\"message\">\n        <p class=\"live-update__message\">Waiting for the server...</p>\n      </div>\n"
+		indexHTMLContent = strings.Replace(indexHTMLContent, "    </div>\n  </main>", liveUpdate+"    </div>\n  </main>", 1)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "index.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating index.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(indexHTMLContent)
+	if err != nil {
+		fmt.Println("error writing index.html content to file: ", err)
+	}
+}
+
+func createDashboardHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	dashboardHTMLContent, err := executeSourceTemplate("source/template/dashboard.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if opts.avatars {
+		accountLink := "              Account\n            </a>\n          </li>\n"
+		avatarLink := "          <li class=\"dashboard__navigation-item\">\n" +
+			"            <a class=\"dashboard__navigation-link\" href=\"/account/avatar\">\n" +
+			"              <svg xmlns=\"http://www.w3.org/2000/svg\" fill=\"none\" viewBox=\"0 0 24 24\" stroke-width=\"1.5\"\n" +
+			"                stroke=\"currentColor\" class=\"size-6\">\n" +
+			"                <path stroke-linecap=\"round\" stroke-linejoin=\"round\"\n" +
+			"                  d=\"M17.982 18.725A7.488 7.488 0 0 0 12 15.75a7.488 7.488 0 0 0-5.982 2.975m11.963 0a9 9 0 1 0-11.963 0m11.963 0A8.966 8.966 0 0 1 12 21a8.966 8.966 0 0 1-5.982-2.275M15 9.75a3 3 0 1 1-6 0 3 3 0 0 1 6 0Z\" />\n" +
+			"              </svg>\n" +
+			"              Avatar\n" +
+			"            </a>\n" +
+			"          </li>\n"
+		dashboardHTMLContent = strings.Replace(dashboardHTMLContent, accountLink, accountLink+avatarLink, 1)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "dashboard.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating dashboard.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(dashboardHTMLContent)
+	if err != nil {
+		fmt.Println("error writing dashboard.html content to file: ", err)
+	}
+}
+
+func createAdminHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	adminHTMLContent, err := executeSourceTemplate("source/template/admin.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if opts.db == "mysql" {
+		backupLink := `      <a class="btn admin__backup" href="/admin/backup" hx-boost="false" download>Download database backup</a>` + "\n"
+		adminHTMLContent = strings.Replace(adminHTMLContent, backupLink, "", 1)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "admin.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating admin.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(adminHTMLContent)
+	if err != nil {
+		fmt.Println("error writing admin.html content to file: ", err)
+	}
+}
+
+func createAdminEventsHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	eventsHTMLContent, err := executeSourceTemplate("source/template/admin-events.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "admin-events.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating admin-events.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(eventsHTMLContent)
+	if err != nil {
+		fmt.Println("error writing admin-events.html content to file: ", err)
+	}
+}
+
+func createAdminUsersHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	usersHTMLContent, err := executeSourceTemplate("source/template/admin-users.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "admin-users.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating admin-users.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(usersHTMLContent)
+	if err != nil {
+		fmt.Println("error writing admin-users.html content to file: ", err)
+	}
+}
+
+func createAccountAvatarHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	avatarHTMLContent, err := executeSourceTemplate("source/avatar/account-avatar.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "account-avatar.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating account-avatar.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(avatarHTMLContent)
+	if err != nil {
+		fmt.Println("error writing account-avatar.html content to file: ", err)
+	}
+}
+
+func createAccountHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	accountHTMLContent, err := executeSourceTemplate("source/template/account.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "account.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating account.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(accountHTMLContent)
+	if err != nil {
+		fmt.Println("error writing account.html content to file: ", err)
+	}
+}
+
+func createErrorHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	errorHTMLContent, err := executeSourceTemplate("source/template/error.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if opts.minimal {
+		// minimal projects have no locales to translate from
+		errorHTMLContent = strings.Replace(errorHTMLContent, `{{ t "error.back_home" }}`, "Back to the homepage", 1)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "error.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating error.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(errorHTMLContent)
+	if err != nil {
+		fmt.Println("error writing error.html content to file: ", err)
+	}
+}
+
+func createVerifyHtmlFile(projectDir string, opts projectOptions) {
+	title := opts.displayTitle(projectDir)
+
+	verifyHTMLContent, err := executeSourceTemplate("source/template/verify.html", map[string]string{
+		"Title": title,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "template", "verify.html")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating verify.html file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(verifyHTMLContent)
+	if err != nil {
+		fmt.Println("error writing verify.html content to file: ", err)
+	}
+}
+
+// bundledHtmxVersion is the version of source/static/htmx.min.js, bump it
+// whenever that file is updated.
+const bundledHtmxVersion = "2.0.0"
+
+// minGoVersion is the oldest Go the modules pinned in source/gomod build
+// with, templ needs a newer one than the rest.
+func (opts projectOptions) minGoVersion() string {
+	if opts.templ {
+		return "1.25"
+	}
+
+	return "1.22"
+}
+
+// defaultGoVersion is the major.minor release napp was built with, or
+// minimum when that is newer.
+func defaultGoVersion(minimum string) string {
+	version := strings.TrimPrefix(runtime.Version(), "go")
+	if major, rest, ok := strings.Cut(version, "."); ok {
+		minor, _, _ := strings.Cut(rest, ".")
+		version = major + "." + minor
+	}
+
+	// development builds and release candidates have no image to build with
+	if isInvalidGoVersion(version) || compareGoVersions(version, minimum) < 0 {
+		return minimum
+	}
+
+	return version
+}
+
+func isInvalidGoVersion(version string) bool {
+	pattern := `^1\.[0-9]+(\.[0-9]+)?$`
+
+	matched, err := regexp.MatchString(pattern, version)
+	if err != nil {
+		return true
+	}
+
+	return !matched
+}
+
+// compareGoVersions orders two releases such as 1.22 and 1.22.4, treating a
+// missing patch as 0.
+func compareGoVersions(a string, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for i := 0; i < 3; i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// goModVersion spells version the way go.mod wants it. A go line of 1.22
+// would sort before the 1.22.0 the modules ask for, and go would want to
+// rewrite it.
+func goModVersion(version string) string {
+	if strings.Count(version, ".") == 1 {
+		return version + ".0"
+	}
+
+	return version
+}
+
+func isInvalidHtmxVersion(version string) bool {
+	pattern := `^[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.]+)?$`
+
+	matched, err := regexp.MatchString(pattern, version)
+	if err != nil {
+		return true
+	}
+
+	return !matched
+}
+
+// htmxDownloadURL is where --htmx-version releases are fetched from.
+var htmxDownloadURL = "https://unpkg.com/htmx.org@"
+
+// downloadHtmx fetches the minified build of an exact htmx release.
+func downloadHtmx(version string) ([]byte, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+
+	res, err := client.Get(htmxDownloadURL + version + "/dist/htmx.min.js")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// createHtmxFile writes the requested htmx version to static, falling back to
+// the bundled copy when no version is given or it cannot be downloaded.
+func createHtmxFile(projectDir string, version string) {
+	htmxJsContent, err := source.ReadFile("source/static/htmx.min.js")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+	}
+
+	if version != "" && version != bundledHtmxVersion {
+		downloaded, err := downloadHtmx(version)
+		if err != nil {
+			fmt.Println("error downloading htmx "+version+", using the bundled "+bundledHtmxVersion+" instead: ", err)
+		} else {
+			htmxJsContent = downloaded
+		}
+	}
+
+	filePath := filepath.Join(projectDir, "static", "htmx.min.js")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating htmx.min.js file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(htmxJsContent))
+	if err != nil {
+		fmt.Println("error writing htmx.min.js content to file: ", err)
+	}
+}
+
+// staticExtra is a companion library --with copies into static and links in
+// the layout after htmx. The pinned release is embedded at
+// source/extras/<file>, bump version whenever that file is updated.
+type staticExtra struct {
+	name    string
+	file    string
+	version string
+}
+
+var staticExtras = []staticExtra{
+	{"alpine", "alpine.min.js", "3.14.8"},
+	{"hyperscript", "_hyperscript.min.js", "0.9.14"},
+}
+
+func staticExtraNames() []string {
+	names := make([]string, 0, len(staticExtras))
+	for _, extra := range staticExtras {
+		names = append(names, extra.name)
+	}
+
+	return names
+}
+
+func isInvalidExtras(names []string) bool {
+	seen := map[string]bool{}
+	for _, name := range names {
+		if !slices.Contains(staticExtraNames(), name) || seen[name] {
+			return true
+		}
+		seen[name] = true
+	}
+
+	return false
+}
+
+// staticExtras returns the libraries picked with --with, in the order
+// staticExtras lists them so the layout does not depend on flag order.
+func (opts projectOptions) staticExtras() []staticExtra {
+	var extras []staticExtra
+	for _, extra := range staticExtras {
+		if slices.Contains(opts.extras, extra.name) {
+			extras = append(extras, extra)
+		}
+	}
+
+	return extras
+}
+
+// checkStaticExtras makes sure every library picked with --with is embedded,
+// before any of the project is written.
+func checkStaticExtras(names []string) error {
+	for _, extra := range (projectOptions{extras: names}).staticExtras() {
+		if _, err := fs.Stat(source, "source/extras/"+extra.file); err != nil {
+			return withExitCode(exitFilesystem, fmt.Errorf("error reading source %s file: %w", extra.file, err))
+		}
+	}
+
+	return nil
+}
+
+// createExtraFiles writes the libraries picked with --with to static.
+func createExtraFiles(projectDir string, names []string) error {
+	for _, extra := range (projectOptions{extras: names}).staticExtras() {
+		content, err := source.ReadFile("source/extras/" + extra.file)
+		if err != nil {
+			return withExitCode(exitFilesystem, fmt.Errorf("error reading source %s file: %w", extra.file, err))
+		}
+
+		err = os.WriteFile(filepath.Join(projectDir, "static", extra.file), content, 0644)
+		if err != nil {
+			return withExitCode(exitFilesystem, fmt.Errorf("error writing %s content to file: %w", extra.file, err))
+		}
+	}
+
+	return nil
+}
+
+// installedHtmxVersion reads the version out of a project's htmx.min.js.
+func installedHtmxVersion(projectDir string) string {
+	content, err := os.ReadFile(filepath.Join(projectDir, "static", "htmx.min.js"))
+	if err != nil {
+		return "unknown"
+	}
+
+	match := regexp.MustCompile(`version:\s*"([^"]+)"`).FindSubmatch(content)
+	if match == nil {
+		return "unknown"
+	}
+
+	return string(match[1])
+}
+
+func createTwColorsFile(projectDir string) {
+	cssContent, err := source.ReadFile("source/static/twcolors.min.css")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+	}
+
+	filePath := filepath.Join(projectDir, "static", "twcolors.min.css")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating twcolors.min.css file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(cssContent))
+	if err != nil {
+		fmt.Println("error writing twcolors.min.css content to file: ", err)
+	}
+}
+
+// createFaviconFiles writes the default icon, an SVG for browsers that
+// support them and a favicon.ico for those that do not.
+func createFaviconFiles(projectDir string) {
+	for _, name := range []string{"favicon.ico", "favicon.svg"} {
+		content, err := source.ReadFile("source/static/" + name)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source %s file: %w", name, err))
+		}
+
+		f, err := os.Create(filepath.Join(projectDir, "static", name))
+		if err != nil {
+			fmt.Println("error creating "+name+" file: ", err)
+			continue
+		}
+
+		_, err = f.Write(content)
+		if err != nil {
+			fmt.Println("error writing "+name+" content to file: ", err)
+		}
+		f.Close()
+	}
+}
+
+// createManifestFile writes a manifest.webmanifest named after the project,
+// which is what lets browsers offer to install the site.
+func createManifestFile(projectDir string, opts projectOptions) {
+	name, err := json.Marshal(opts.displayTitle(projectDir))
+	if err != nil {
+		fmt.Println("error encoding manifest name: ", err)
+	}
+
+	manifestContent, err := executeSourceTemplate("source/static/manifest.webmanifest", map[string]string{
+		"JSONTitle": string(name),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "static", "manifest.webmanifest")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating manifest.webmanifest file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(manifestContent)
+	if err != nil {
+		fmt.Println("error writing manifest.webmanifest content to file: ", err)
+	}
+}
+
+func createCssFile(projectDir string) {
+	cssContent, err := source.ReadFile("source/static/styles.css")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+	}
+
+	filePath := filepath.Join(projectDir, "static", "styles.css")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating styles.css file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(cssContent))
+	if err != nil {
+		fmt.Println("error writing styles.css content to file: ", err)
+	}
+}
+
+func createTailwindConfigFile(projectDir string) {
+	configContent, err := source.ReadFile("source/tailwind/tailwind.config.js")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source tailwind.config.js file: %w", err))
+	}
+
+	filePath := filepath.Join(projectDir, "tailwind.config.js")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating tailwind.config.js file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(configContent))
+	if err != nil {
+		fmt.Println("error writing tailwind.config.js content to file: ", err)
+	}
+}
+
+func createTailwindInputFile(projectDir string) {
+	directives, err := source.ReadFile("source/tailwind/input.css")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source input.css file: %w", err))
+	}
+
+	// The built stylesheet replaces static/styles.css, so the existing styles
+	// are carried over beneath the tailwind directives.
+	cssContent, err := source.ReadFile("source/static/styles.css")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source styles.css file: %w", err))
+	}
+
+	filePath := filepath.Join(projectDir, "input.css")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating input.css file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(string(directives) + string(cssContent))
+	if err != nil {
+		fmt.Println("error writing input.css content to file: ", err)
+	}
+}
+
+func createPackageJsonFile(projectDir string) {
+	projectName := filepath.Base(projectDir)
+
+	packageJsonContent, err := executeSourceTemplate("source/tailwind/package.json", map[string]string{
+		"Name": strings.ToLower(projectName),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "package.json")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating package.json file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(packageJsonContent)
+	if err != nil {
+		fmt.Println("error writing package.json content to file: ", err)
+	}
+}
+
+func createIgnoreFile(projectDir string, opts projectOptions) {
+	projectName := filepath.Base(projectDir)
+
+	dbFilename := strings.ToLower(projectName) + ".db"
+	if opts.db == "mysql" {
+		dbFilename = ""
+	}
+	envFilename := ".env"
+	nodeModules := ""
+	if opts.css == "tailwind" {
+		nodeModules = "node_modules"
+	}
+	uploadsDir := ""
+	if opts.avatars {
+		uploadsDir = "uploads"
+	}
+	backupsDir := "backups"
+	if opts.minimal || opts.db == "mysql" {
+		backupsDir = ""
+	}
+
+	ignoreContent, err := executeSourceTemplate("source/.gitignore", map[string]string{
+		"EnvFile":      envFilename,
+		"DatabaseFile": dbFilename,
+		"NodeModules":  nodeModules,
+		"UploadsDir":   uploadsDir,
+		"BackupsDir":   backupsDir,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, ".gitignore")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating .gitignore file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(ignoreContent)
+	if err != nil {
+		fmt.Println("error writing .gitignore content to file: ", err)
+	}
+}
+
+// createLocaleFile writes locales/en.json with the messages the handlers
+// translate, including those of the optional features the project uses.
+func createLocaleFile(projectDir string, opts projectOptions) {
+	sources := []string{"source/locales/en.json"}
+	if len(opts.oauth) > 0 {
+		sources = append(sources, "source/oauth/en.json")
+	}
+	if opts.avatars {
+		sources = append(sources, "source/avatar/en.json")
+	}
+
+	messages := map[string]string{}
+	for _, name := range sources {
+		content, err := source.ReadFile(name)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source %s file: %w", name, err))
+			continue
+		}
+
+		err = json.Unmarshal(content, &messages)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error parsing source %s file: %w", name, err))
+		}
+	}
+
+	filePath := filepath.Join(projectDir, "locales", "en.json")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating en.json file: ", err)
+	}
+	defer f.Close()
+
+	// messages are shown as written, so <, > and & are left as they are
+	encoder := json.NewEncoder(f)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(messages)
+	if err != nil {
+		fmt.Println("error writing en.json content to file: ", err)
+	}
+}
+
+func createDotEnvFile(projectDir string, opts projectOptions) {
+	projectName := filepath.Base(projectDir)
+
+	var dotenvContent string
+	if opts.minimal {
+		minimalDotenvContent, err := source.ReadFile("source/minimal/.env")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source minimal .env file: %w", err))
+		}
+
+		dotenvContent = string(minimalDotenvContent)
+	} else {
+		dbEnv := envPrefix(projectName) + "_DB_PATH"
+		sessEnv := envPrefix(projectName) + "_COOKIE_STORE_SECRET"
+		dbFilename := strings.ToLower(projectName) + ".db"
+
+		sessSecret, err := randomSecret()
+		if err != nil {
+			fmt.Println("error generating session secret: ", err)
+		}
+
+		dbConfig := dbEnv + "=\"" + dbFilename + "\""
+		if opts.db == "mysql" {
+			dbName := strings.ReplaceAll(strings.ToLower(projectName), "-", "_")
+			mysqlConfig, err := executeSourceTemplate("source/db/mysql.env", map[string]string{
+				"DatabaseName": dbName,
+			})
+			if err != nil {
+				fmt.Println(err)
+			}
+			dbConfig = strings.TrimSuffix(mysqlConfig, "\n")
+		}
+
+		dotenvContent, err = executeSourceTemplate("source/.env", map[string]string{
+			"DatabaseConfig": dbConfig,
+			"SessionEnv":     sessEnv,
+			"SessionSecret":  sessSecret,
+			"SessionStore":   opts.sessionStore,
+		})
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		for _, provider := range opts.oauth {
+			prefix := strings.ToUpper(provider)
+			dotenvContent += prefix + "_CLIENT_ID=\"\"\n" + prefix + "_CLIENT_SECRET=\"\"\n"
+		}
+
+		if opts.avatars {
+			dotenvContent += "UPLOADS_DIR=\"uploads\"\n"
+		}
+	}
+
+	filePath := filepath.Join(projectDir, ".env")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating .env file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(dotenvContent)
+	if err != nil {
+		fmt.Println("error writing database content to file: ", err)
+	}
+}
+
+func randomSecret() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+const migrationVersionFormat = "20060102150405"
+
+// createInitialMigrationFile writes the first migration, creating the tables
+// the generated app starts with for the chosen database.
+func createInitialMigrationFile(projectDir string, opts projectOptions) {
+	migrationContent, err := source.ReadFile("source/migrations/" + opts.db + ".sql")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source %s.sql file: %w", opts.db, err))
+	}
+
+	columnType := "text"
+	if opts.db == "mysql" {
+		columnType = "varchar(191)"
+	}
+	for _, provider := range opts.oauth {
+		column := provider + "_id"
+		migrationContent = append(migrationContent, []byte("\nALTER TABLE `users` ADD COLUMN `"+column+"` "+columnType+";\n\n"+
+			"CREATE UNIQUE INDEX `idx_users_"+column+"` ON `users`(`"+column+"`);\n")...)
+	}
+	if opts.avatars {
+		migrationContent = append(migrationContent, []byte("\nALTER TABLE `users` ADD COLUMN `avatar_path` "+columnType+";\n")...)
+	}
+
+	fileName := time.Now().Format(migrationVersionFormat) + "_create_tables.sql"
+	filePath := filepath.Join(projectDir, "migrations", fileName)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating "+fileName+" file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(migrationContent)
+	if err != nil {
+		fmt.Println("error writing "+fileName+" content to file: ", err)
+	}
+}
+
+func createSqliteDbFile(projectDir string) {
+	projectName := filepath.Base(projectDir)
+
+	dbfileName := strings.ToLower(projectName) + ".db"
+	filePath := filepath.Join(projectDir, dbfileName)
+
+	_, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating database file: ", err)
+	}
+}
+
+// runtimeDirs are the directories the app reads from disk when it runs,
+// --embed builds them all into the binary instead.
+func (opts projectOptions) runtimeDirs() []string {
+	if opts.embed {
+		return nil
+	}
+
+	dirs := []string{"static"}
+	if !opts.templ {
+		dirs = append(dirs, "template")
+	}
+	if !opts.minimal {
+		dirs = append(dirs, "locales")
+	}
+	if opts.migrations {
+		dirs = append(dirs, "migrations")
+	}
+
+	return dirs
+}
+
+func createDockerfile(projectDir string, opts projectOptions) {
+	var copyAssets string
+	for _, dir := range opts.runtimeDirs() {
+		copyAssets += "\nCOPY " + dir + " ./" + dir + "\n"
+	}
+
+	// projects made before --go-version build with the Go in their go.mod
+	goVersion := opts.goVersion
+	if goVersion == "" {
+		goVersion = defaultGoVersion(opts.minGoVersion())
+	}
+
+	dockerfileContent, err := executeSourceTemplate("source/Dockerfile", map[string]string{
+		"GoVersion":   goVersion,
+		"MainPackage": opts.mainPackage(),
+		"CopyAssets":  copyAssets,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "Dockerfile")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating Dockerfile file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(dockerfileContent)
+	if err != nil {
+		fmt.Println("error writing Dockerfile content to file: ", err)
+	}
+}
+
+func createDockerIgnoreFile(projectDir string) {
+	dockerIgnoreContent, err := source.ReadFile("source/.dockerignore")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source .dockerignore file: %w", err))
+	}
+
+	filePath := filepath.Join(projectDir, ".dockerignore")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating .dockerignore file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(dockerIgnoreContent)
+	if err != nil {
+		fmt.Println("error writing .dockerignore content to file: ", err)
+	}
+}
+
+// goModVariant picks the source/gomod directory whose go.mod and go.sum
+// list exactly the modules the project imports, so it builds without go mod
+// tidy.
+func (opts projectOptions) goModVariant() string {
+	if opts.minimal {
+		if opts.templ {
+			return "minimal-templ"
+		}
+		return "minimal"
+	}
+
+	variant := opts.db
+	if len(opts.oauth) > 0 {
+		variant += "-oauth"
+	}
+	return variant
+}
+
+func createGoModFiles(projectDir string, opts projectOptions) {
+	variant := opts.goModVariant()
+
+	goModContent, err := executeSourceTemplate("source/gomod/"+variant+"/go.mod.tmpl", map[string]string{
+		"Name":      filepath.Base(projectDir),
+		"GoVersion": goModVersion(opts.goVersion),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	err = os.WriteFile(filepath.Join(projectDir, "go.mod"), []byte(goModContent), 0644)
+	if err != nil {
+		fmt.Println("error writing go.mod file: ", err)
+	}
+
+	goSumContent, err := source.ReadFile("source/gomod/" + variant + "/go.sum")
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source go.sum file: %w", err))
+	}
+
+	err = os.WriteFile(filepath.Join(projectDir, "go.sum"), goSumContent, 0644)
+	if err != nil {
+		fmt.Println("error writing go.sum file: ", err)
+	}
+}
+
+func createMakefile(projectDir string, opts projectOptions) {
+	projectName := filepath.Base(projectDir)
+
+	makefileContent, err := executeSourceTemplate("source/Makefile", map[string]string{
+		"Name":        strings.ToLower(projectName),
+		"MainPackage": opts.mainPackage(),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	if !opts.noDocker {
+		dockerTargets, err := source.ReadFile("source/docker.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source docker.mk file: %w", err))
+		}
+
+		makefileContent += string(dockerTargets)
+	}
+
+	if !opts.minimal {
+		seedTarget, err := source.ReadFile("source/seed.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source seed.mk file: %w", err))
+		}
+
+		makefileContent += string(seedTarget)
+	}
+
+	if !opts.minimal && opts.db == "sqlite" {
+		backupTarget, err := source.ReadFile("source/backup.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source backup.mk file: %w", err))
+		}
+
+		makefileContent += string(backupTarget)
+	}
+
+	if opts.migrations {
+		migrateTargets, err := source.ReadFile("source/migrations/migrate.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source migrate.mk file: %w", err))
+		}
+
+		makefileContent += string(migrateTargets)
+	}
+
+	if opts.templ {
+		generateTarget, err := source.ReadFile("source/templ/templ.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source templ.mk file: %w", err))
+		}
+
+		makefileContent += string(generateTarget)
+	}
+
+	if opts.air {
+		devTarget, err := source.ReadFile("source/air/dev.mk")
+		if err != nil {
+			fmt.Println(fmt.Errorf("error reading source dev.mk file: %w", err))
+		}
+
+		makefileContent += string(devTarget)
+	}
+
+	filePath := filepath.Join(projectDir, "Makefile")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating Makefile file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(makefileContent)
+	if err != nil {
+		fmt.Println("error writing Makefile content to file: ", err)
+	}
+}
+
+func createAirConfigFile(projectDir string, opts projectOptions) {
+	airConfigContent, err := executeSourceTemplate("source/air/.air.toml", map[string]string{
+		"MainPackage": opts.mainPackage(),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	if !opts.minimal {
+		// the locales are read at startup, so editing them needs a restart
+		airConfigContent = strings.Replace(airConfigContent, `include_ext = ["go", "html", "css"]`, `include_ext = ["go", "html", "css", "json"]`, 1)
+	}
+	if opts.templ {
+		airConfigContent = strings.NewReplacer(
+			`cmd = "go build`, `cmd = "templ generate && go build`,
+			`include_ext = ["go", "html", "css"]`, `include_ext = ["go", "templ", "css"]`,
+			`exclude_regex = ["_test\\.go$",`, `exclude_regex = ["_test\\.go$", "_templ\\.go$",`,
+		).Replace(airConfigContent)
+	}
+
+	filePath := filepath.Join(projectDir, ".air.toml")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating .air.toml file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(airConfigContent)
+	if err != nil {
+		fmt.Println("error writing .air.toml content to file: ", err)
+	}
+}
+
+// deployFiles is the platform config --deploy writes for each target.
+var deployFiles = map[string]string{
+	"fly":     "fly.toml",
+	"render":  "render.yaml",
+	"railway": "railway.json",
+	"dokku":   "app.json",
+}
+
+func createDeployFile(projectDir string, deploy string) {
+	projectName := filepath.Base(projectDir)
+
+	name := strings.ToLower(projectName)
+	prefix := envPrefix(projectName)
+
+	fileName := deployFiles[deploy]
+
+	deployContent, err := executeSourceTemplate("source/deploy/"+fileName, map[string]string{
+		"Name":       name,
+		"EnvPrefix":  prefix,
+		"VolumeName": strings.ReplaceAll(name, "-", "_"),
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, fileName)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating "+fileName+" file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(deployContent)
+	if err != nil {
+		fmt.Println("error writing "+fileName+" content to file: ", err)
+	}
+}
+
+func printDeploySteps(projectName string, deploy string) {
+	name := strings.ToLower(projectName)
+	prefix := envPrefix(projectName)
+
+	fmt.Println("To deploy to " + deploy + ":")
+
+	switch deploy {
+	case "fly":
+		fmt.Println("fly launch --copy-config --no-deploy")
+		fmt.Println("fly secrets set " + prefix + "_COOKIE_STORE_SECRET=<your-secret>")
+		fmt.Println("fly deploy")
+	case "render":
+		fmt.Println("push the project to GitHub or GitLab")
+		fmt.Println("create a new Blueprint in the Render dashboard from the repository")
+	case "railway":
+		fmt.Println("railway init")
+		fmt.Println("add a volume mounted at /data in the Railway dashboard")
+		fmt.Println("railway variables --set APP_ENV=production --set APP_URL=https://<your-domain> --set " + prefix + "_DB_PATH=/data/" + name + ".db --set " + prefix + "_COOKIE_STORE_SECRET=<your-secret>")
+		fmt.Println("railway up")
+	case "dokku":
+		fmt.Println("dokku apps:create " + name)
+		fmt.Println("dokku storage:mount " + name + " /var/lib/dokku/data/storage/" + name + ":/data")
+		fmt.Println("dokku config:set " + name + " APP_ENV=production APP_URL=https://<your-domain> " + prefix + "_DB_PATH=/data/" + name + ".db " + prefix + "_COOKIE_STORE_SECRET=<your-secret>")
+		fmt.Println("dokku ports:set " + name + " http:80:8080")
+		fmt.Println("git remote add dokku dokku@<your-server>:" + name)
+		fmt.Println("git push dokku main")
+	}
+}
+
+// createReadmeFile writes a README.md with the commands to run the project,
+// the settings in its .env and how to ship the app. It reads the .env
+// createProject has already written, so it lists exactly the keys generated.
+func createReadmeFile(projectDir string, opts projectOptions) {
+	projectName := filepath.Base(projectDir)
+	name := strings.ToLower(projectName)
+
+	description := opts.description
+	if description == "" {
+		description = "A web app generated with [napp](https://github.com/damiensedgwick/napp)."
+	}
+
+	var runCommands []string
+	if opts.templ {
+		runCommands = append(runCommands, "go install github.com/a-h/templ/cmd/templ@latest", "templ generate")
+	}
+	if opts.css == "tailwind" {
+		runCommands = append(runCommands, "npm install", "npm run build:css")
+	}
+	runCommands = append(runCommands, "go run "+opts.mainPackage())
+	if opts.air {
+		runCommands = append(runCommands, "# or rebuild on every change with air", "make dev")
+	}
+
+	env, err := godotenv.Read(filepath.Join(projectDir, ".env"))
+	if err != nil {
+		fmt.Println("error reading .env file: ", err)
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var envVars strings.Builder
+	required := requiredEnvKeys(projectName, opts)
+	if len(required) > 0 {
+		envVars.WriteString("The app will not start without `" + strings.Join(required, "`, `") + "`.\n")
+	}
+	if opts.db == "mysql" && !opts.minimal {
+		envVars.WriteString("Create the MySQL database named in `MYSQL_DATABASE` before the first run.\n")
+	}
+	envVars.WriteString("\n")
+	for _, key := range keys {
+		envVars.WriteString("- `" + key + "`\n")
+	}
+
+	goVersion := opts.goVersion
+	if goVersion == "" {
+		goVersion = defaultGoVersion(opts.minGoVersion())
+	}
+
+	var deployNotes string
+	if opts.noDocker {
+		deployNotes = "`make build` compiles the app to `bin/" + name + "` with Go " + goVersion + "."
+		if opts.embed {
+			deployNotes += " The templates and static files are embedded, so the binary only needs a `.env` next to it."
+		} else {
+			var holding []string
+			for _, dir := range opts.runtimeDirs() {
+				holding = append(holding, "`"+dir+"/`")
+			}
+			deployNotes += " Run it from a directory holding " + strings.Join(holding, ", ") + " and `.env`, as the app reads them from there."
+		}
+	} else {
+		deployNotes = "The `Dockerfile` builds with Go " + goVersion + " and runs the app as a non-root user on port 8080.\n\n```sh\nmake docker-build\nmake docker-run\n```"
+	}
+	deployNotes += "\n\nIn production set `APP_ENV=\"production\"`, settings in `.env.production` take priority over `.env`."
+	if !opts.minimal {
+		deployNotes += " Generate a new `" + envPrefix(projectName) + "_COOKIE_STORE_SECRET` with `openssl rand -hex 32`."
+	}
+	if !opts.minimal && opts.db == "sqlite" && opts.noDocker {
+		deployNotes += "\n\nPoint `" + envPrefix(projectName) + "_DB_PATH` somewhere outside the release directory so the SQLite database survives deploys."
+	}
+	if !opts.minimal && opts.db == "sqlite" && !opts.noDocker {
+		dbEnv := envPrefix(projectName) + "_DB_PATH"
+		deployNotes += "\n\nThe image has a `/data` directory the app can write to. Mount a volume there and point `" + dbEnv +
+			"` at it so the SQLite database survives restarts:\n\n```sh\ndocker run -p 8080:8080 -v " + name + "-data:/data -e " +
+			dbEnv + "=/data/" + name + ".db " + name + "\n```"
+	}
+	if opts.db == "mysql" && !opts.minimal {
+		deployNotes += " Point the `MYSQL_` settings at a database the app can reach."
+	}
+	if opts.deploy == "" {
+		ports := "publish ports 80 and 443"
+		if opts.noDocker {
+			ports = "let the app listen on ports 80 and 443"
+		}
+		deployNotes += "\n\nTo serve HTTPS without a reverse proxy, set `DOMAIN` and " + ports + ", the app gets its certificates from Let's Encrypt and caches them in `CERT_CACHE_DIR`."
+	}
+	if opts.deploy != "" {
+		deployNotes += "\n\n`" + deployFiles[opts.deploy] + "` deploys the same image, wired up to the `/healthz` endpoint and a volume at `/data`."
+	}
+
+	readmeContent, err := executeSourceTemplate("source/README.md", map[string]string{
+		"Title":       opts.displayTitle(projectDir),
+		"Description": description,
+		"RunCommands": strings.Join(runCommands, "\n"),
+		"EnvVars":     strings.TrimSuffix(envVars.String(), "\n"),
+		"DeployNotes": deployNotes,
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	filePath := filepath.Join(projectDir, "README.md")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating README.md file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(readmeContent)
+	if err != nil {
+		fmt.Println("error writing README.md content to file: ", err)
+	}
+}
+
+// createLicenseFile fills the copyright line of the chosen license with the
+// current year and the author.
+func createLicenseFile(projectDir string, opts projectOptions) {
+	licenseTemplate, err := source.ReadFile("source/license/" + opts.license)
+	if err != nil {
+		fmt.Println(fmt.Errorf("error reading source %s license file: %w", opts.license, err))
+	}
+
+	licenseContent := strings.NewReplacer(
+		"[yyyy]", strconv.Itoa(time.Now().Year()),
+		"[name of copyright owner]", opts.author,
+	).Replace(string(licenseTemplate))
+
+	filePath := filepath.Join(projectDir, "LICENSE")
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating LICENSE file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(licenseContent)
+	if err != nil {
+		fmt.Println("error writing LICENSE content to file: ", err)
+	}
+}
+
+// addLicenseHeaders puts a copyright and SPDX identifier comment above the
+// package clause of every .go file napp generated.
+func addLicenseHeaders(projectDir string, opts projectOptions) {
+	header := "// Copyright (c) " + strconv.Itoa(time.Now().Year()) + " " + opts.author + "\n" +
+		"// SPDX-License-Identifier: " + opts.license + "\n\n"
+
+	err := filepath.WalkDir(projectDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".go" {
+			return err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(path, append([]byte(header), content...), 0644)
+	})
+	if err != nil {
+		fmt.Println("error adding license headers: ", err)
+	}
+}
+
+// initGitRepo creates the initial commit for a new project. Git is optional,
+// so any failure is reported as a warning rather than failing the init.
+func initGitRepo(projectDir string) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		fmt.Println("warning: git is not installed, skipping repository initialisation")
+		return
+	}
+
+	commands := [][]string{
+		{"git", "init"},
+		{"git", "add", "."},
+		{"git", "commit", "-m", "Initial commit from napp"},
+	}
+
+	for _, command := range commands {
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Dir = projectDir
+
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			fmt.Println("warning: " + strings.Join(command, " ") + " failed: " + strings.TrimSpace(string(output)))
+			return
+		}
+	}
+}
+
+type regenFile struct {
+	name   string
+	path   string
+	create func(projectDir string, opts projectOptions)
+}
+
+// regenFiles are the files napp regen can rewrite, each one is written by the
+// same createX helper that napp init uses.
+var regenFiles = []regenFile{
+	{"dockerfile", "Dockerfile", createDockerfile},
+	{"dockerignore", ".dockerignore", func(projectDir string, opts projectOptions) {
+		createDockerIgnoreFile(projectDir)
+	}},
+	{"gitignore", ".gitignore", createIgnoreFile},
+	{"makefile", "Makefile", createMakefile},
+	{"air", ".air.toml", createAirConfigFile},
+	{"htmx", filepath.Join("static", "htmx.min.js"), func(projectDir string, opts projectOptions) {
+		createHtmxFile(projectDir, opts.htmxVersion)
+	}},
+	{"twcolors", filepath.Join("static", "twcolors.min.css"), func(projectDir string, opts projectOptions) {
+		createTwColorsFile(projectDir)
+	}},
+	{"styles", filepath.Join("static", "styles.css"), func(projectDir string, opts projectOptions) {
+		createCssFile(projectDir)
+	}},
+}
+
+func regenFileNames() []string {
+	names := make([]string, 0, len(regenFiles))
+	for _, f := range regenFiles {
+		names = append(names, f.name)
+	}
+
+	return names
+}
+
+func findRegenFile(name string) (regenFile, bool) {
+	for _, f := range regenFiles {
+		if f.name == strings.ToLower(name) {
+			return f, true
+		}
+	}
+
+	return regenFile{}, false
+}
+
+// configFileName is where a project records the options it was generated
+// with.
+const configFileName = "napp.json"
+
+// projectConfig is the napp.json form of projectOptions, written by init so
+// generate, regen and upgrade work from the choices the project was made with
+// rather than guessing them from its files.
+type projectConfig struct {
+	CSS            string   `json:"css"`
+	DB             string   `json:"db"`
+	Migrations     bool     `json:"migrations"`
+	Minimal        bool     `json:"minimal"`
+	TemplateEngine string   `json:"templateEngine"`
+	Embed          bool     `json:"embed"`
+	Air            bool     `json:"air"`
+	Worker         bool     `json:"worker"`
+	Avatars        bool     `json:"avatars"`
+	SSE            bool     `json:"sse"`
+	Manifest       bool     `json:"manifest"`
+	SessionStore   string   `json:"sessionStore"`
+	OAuth          []string `json:"oauth,omitempty"`
+	Deploy         string   `json:"deploy,omitempty"`
+	HtmxVersion    string   `json:"htmxVersion,omitempty"`
+	With           []string `json:"with,omitempty"`
+	GoVersion      string   `json:"goVersion,omitempty"`
+	Title          string   `json:"title,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	NoDocker       bool     `json:"noDocker,omitempty"`
+}
+
+func (opts projectOptions) config() projectConfig {
+	engine := "html"
+	if opts.templ {
+		engine = "templ"
+	}
+
+	return projectConfig{
+		CSS:            opts.css,
+		DB:             opts.db,
+		Migrations:     opts.migrations,
+		Minimal:        opts.minimal,
+		TemplateEngine: engine,
+		Embed:          opts.embed,
+		Air:            opts.air,
+		Worker:         opts.worker,
+		Avatars:        opts.avatars,
+		SSE:            opts.sse,
+		Manifest:       opts.manifest,
+		SessionStore:   opts.sessionStore,
+		OAuth:          opts.oauth,
+		Deploy:         opts.deploy,
+		HtmxVersion:    opts.htmxVersion,
+		With:           opts.extras,
+		GoVersion:      opts.goVersion,
+		Title:          opts.title,
+		Description:    opts.description,
+		NoDocker:       opts.noDocker,
+	}
+}
+
+func (cfg projectConfig) options() projectOptions {
+	return projectOptions{
+		css:          cfg.CSS,
+		db:           cfg.DB,
+		migrations:   cfg.Migrations,
+		minimal:      cfg.Minimal,
+		templ:        cfg.TemplateEngine == "templ",
+		embed:        cfg.Embed,
+		air:          cfg.Air,
+		worker:       cfg.Worker,
+		avatars:      cfg.Avatars,
+		sse:          cfg.SSE,
+		manifest:     cfg.Manifest,
+		sessionStore: cfg.SessionStore,
+		oauth:        cfg.OAuth,
+		deploy:       cfg.Deploy,
+		htmxVersion:  cfg.HtmxVersion,
+		extras:       cfg.With,
+		goVersion:    cfg.GoVersion,
+		title:        cfg.Title,
+		description:  cfg.Description,
+		noDocker:     cfg.NoDocker,
+	}
+}
+
+func createConfigFile(projectDir string, opts projectOptions) {
+	configContent, err := json.MarshalIndent(opts.config(), "", "  ")
+	if err != nil {
+		fmt.Println("error encoding napp.json: ", err)
+	}
+
+	filePath := filepath.Join(projectDir, configFileName)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		fmt.Println("error creating napp.json file: ", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(configContent, '\n'))
+	if err != nil {
+		fmt.Println("error writing napp.json content to file: ", err)
+	}
+}
+
+// readProjectConfig loads the options a project recorded in napp.json.
+func readProjectConfig(projectDir string) (projectOptions, error) {
+	content, err := os.ReadFile(filepath.Join(projectDir, configFileName))
+	if err != nil {
+		return projectOptions{}, err
+	}
+
+	var cfg projectConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return projectOptions{}, fmt.Errorf("error parsing %s: %w", configFileName, err)
+	}
+
+	return cfg.options(), nil
+}
+
+// detectProjectOptions reads the init options from napp.json. Projects made
+// before napp wrote one, or whose napp.json is broken, have them worked out
+// from their files instead.
+func detectProjectOptions(projectDir string) projectOptions {
+	opts, err := readProjectConfig(projectDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Println(err.Error() + ", working the options out from the project files instead")
+		}
+
+		opts = guessProjectOptions(projectDir)
+	}
+
+	// projects made before --go-version keep the Go their go.mod asks for
+	if opts.goVersion == "" {
+		opts.goVersion = goModDirective(projectDir)
+	}
+
+	return opts
+}
+
+// goModDirective returns the version on the go line of the project's
+// go.mod, or nothing when there is no go.mod.
+func goModDirective(projectDir string) string {
+	content, err := os.ReadFile(filepath.Join(projectDir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(line), "go "); ok {
+			return strings.TrimSpace(version)
+		}
+	}
+
+	return ""
+}
+
+// guessProjectOptions works out the init options an existing project was
+// generated with from the files it contains, so regenerated files match it.
+func guessProjectOptions(projectDir string) projectOptions {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(projectDir, name))
+		return err == nil
+	}
+
+	opts := projectOptions{
+		css:      "minimal",
+		air:      exists(".air.toml"),
+		embed:    mainGoFile(projectDir) == "main.go",
+		minimal:  isMinimalProject(projectDir),
+		templ:    isTemplProject(projectDir),
+		worker:   hasWorkerFile(projectDir),
+		sse:      exists(filepath.Join("static", "sse.js")),
+		db:       "sqlite",
+		noDocker: !exists("Dockerfile"),
+	}
+	if exists("tailwind.config.js") {
+		opts.css = "tailwind"
+	}
+	if isMySQLProject(projectDir) {
+		opts.db = "mysql"
+	}
+	if exists("migrations") {
+		opts.migrations = true
+	}
+	for _, extra := range staticExtras {
+		if exists(filepath.Join("static", extra.file)) {
+			opts.extras = append(opts.extras, extra.name)
+		}
+	}
+
+	return opts
+}
+
+// confirmOverwrite asks whether path should be replaced, anything other than
+// y or yes, including no input at all, leaves it alone.
+func confirmOverwrite(in io.Reader, out io.Writer, path string) (bool, error) {
+	fmt.Fprint(out, path+" already exists, overwrite it? [y/N] ")
+
+	scanner := bufio.NewScanner(in)
+	if !scanner.Scan() {
+		fmt.Fprintln(out)
+		return false, scanner.Err()
+	}
+
+	answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+
+	return answer == "y" || answer == "yes", nil
+}
+
+// upgradeFiles are the regen files napp upgrade refreshes. They are
+// boilerplate that is rarely edited by hand, unlike main.go and the
+// templates. htmx is left out so a version picked with --htmx-version stays.
+var upgradeFiles = []string{"dockerfile", "dockerignore", "gitignore", "twcolors", "air"}
+
+// upgradeProject writes the upgradeFiles into a scratch copy of the project
+// and swaps in any that differ, copying the old version into backupDir first.
+// It returns the paths that changed.
+func upgradeProject(projectDir string, backupDir string) ([]string, error) {
+	opts := detectProjectOptions(projectDir)
+
+	scratch, err := os.MkdirTemp("", "napp-upgrade")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	// the scratch copy has the same name as the project, which some files
+	// are derived from
+	stageDir := filepath.Join(scratch, filepath.Base(projectDir))
+	err = os.MkdirAll(filepath.Join(stageDir, "static"), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var upgraded []string
+	for _, name := range upgradeFiles {
+		if name == "air" && !opts.air {
+			continue
+		}
+
+		target, _ := findRegenFile(name)
+
+		// --no-docker projects only get the docker files back from regen
+		_, err := os.Stat(filepath.Join(projectDir, target.path))
+		if opts.noDocker && (name == "dockerfile" || name == "dockerignore") && errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		target.create(stageDir, opts)
+
+		latest, err := os.ReadFile(filepath.Join(stageDir, target.path))
+		if err != nil {
+			return upgraded, err
+		}
+
+		projectPath := filepath.Join(projectDir, target.path)
+		current, err := os.ReadFile(projectPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return upgraded, err
+		}
+
+		if err == nil {
+			if bytes.Equal(current, latest) {
+				continue
+			}
+
+			backupPath := filepath.Join(backupDir, target.path)
+			err = os.MkdirAll(filepath.Dir(backupPath), 0755)
+			if err != nil {
+				return upgraded, err
+			}
+
+			err = os.WriteFile(backupPath, current, 0644)
+			if err != nil {
+				return upgraded, err
+			}
+		}
+
+		err = os.WriteFile(projectPath, latest, 0644)
+		if err != nil {
+			return upgraded, err
+		}
+
+		upgraded = append(upgraded, target.path)
+	}
+
+	return upgraded, nil
+}
+
+// listSourceFiles prints the embedded templates as an indented tree with
+// their sizes. Placeholders such as the project name are filled in when a
+// project is generated, so generated files differ slightly in size.
+func listSourceFiles(w io.Writer) error {
+	return fs.WalkDir(source, "source", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == "source" {
+			return err
+		}
+
+		indent := strings.Repeat("  ", strings.Count(path, "/")-1)
+		if d.IsDir() {
+			fmt.Fprintln(w, indent+d.Name()+"/")
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, indent+d.Name()+" ("+formatSize(info.Size())+")")
+
+		return nil
+	})
+}
 
-					if isInvalidProjectName(projectname) {
-						return cli.NewExitError(
-							"Oops! Project name must be in the following format: <project-name>",
-							1,
-						)
-					}
+// dumpSourceFiles copies the embedded templates into outDir as they are, so
+// they can be diffed against a customised project. Existing files are kept.
+func dumpSourceFiles(outDir string) error {
+	return fs.WalkDir(source, "source", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-					ok, _ := createProject(projectname)
-					if ok {
-						fmt.Println("Successfully created " + projectname + ", next steps:")
-						fmt.Println("cd " + projectname)
-						fmt.Println("go mod init")
-						fmt.Println("go mod tidy")
-						fmt.Println("go run cmd/main.go")
-					}
+		target := filepath.Join(outDir, filepath.FromSlash(strings.TrimPrefix(path, "source")))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
 
-					return nil
-				},
-			},
-		},
-		Author: "Damien Sedgwick",
-		Email:  "damienksedgwick@gmail.com",
-	}
+		content, err := source.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading source %s file: %w", path, err)
+		}
 
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		return createFileIfNotExists(target, content)
+	})
+}
+
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
 	}
+
+	return fmt.Sprintf("%.1f KB", float64(size)/1024)
 }
 
-func isInvalidProjectName(name string) bool {
-	pattern := "^[a-z0-9-]+$"
+const routesMarker = "// napp:routes"
 
-	matched, err := regexp.MatchString(pattern, name)
-	if err != nil {
-		return true
+func isNappProject(projectDir string) bool {
+	_, err := os.Stat(filepath.Join(projectDir, mainGoFile(projectDir)))
+	return err == nil
+}
+
+// mainGoFile is the generated entrypoint relative to the project root, which
+// is main.go for projects generated with --embed and cmd/main.go otherwise.
+func mainGoFile(projectDir string) string {
+	_, err := os.Stat(filepath.Join(projectDir, "main.go"))
+	if err == nil {
+		return "main.go"
 	}
 
-	return !matched
+	return filepath.Join("cmd", "main.go")
 }
 
-func createProject(projectName string) (bool, error) {
-	err := os.Mkdir(projectName, 0755)
+// isMinimalProject reports whether the project was generated with --minimal,
+// which leaves out the database and so the models marker.
+func isMinimalProject(projectDir string) bool {
+	content, err := os.ReadFile(filepath.Join(projectDir, mainGoFile(projectDir)))
 	if err != nil {
-		return false, fmt.Errorf("error creating project directory: %w", err)
+		return false
 	}
 
-	subfolders := []string{"cmd", "template", "static"}
-	for _, folder := range subfolders {
-		folderPath := fmt.Sprintf("%s/%s", projectName, folder)
+	return !strings.Contains(string(content), modelsMarker)
+}
 
-		err := os.Mkdir(folderPath, 0755)
-		if err != nil {
-			return false, fmt.Errorf("error creating subfolder %s: %w", folder, err)
-		}
+// isMySQLProject reports whether the project was generated with --db mysql.
+func isMySQLProject(projectDir string) bool {
+	content, err := os.ReadFile(filepath.Join(projectDir, mainGoFile(projectDir)))
+	if err != nil {
+		return false
 	}
 
-	createGoMainFile(projectName)
-	createHtmlFile(projectName)
-	createDashboardHtmlFile(projectName)
-	createHtmxFile(projectName)
-	createTwColorsFile(projectName)
-	createCssFile(projectName)
-	createIgnoreFile(projectName)
-	createDotEnvFile(projectName)
-	createSqliteDbFile(projectName)
-	createDockerfile(projectName)
+	return strings.Contains(string(content), `"gorm.io/driver/mysql"`)
+}
 
-	return true, nil
+func runCommand(projectDir string) string {
+	return "go run " + detectProjectOptions(projectDir).mainPackage()
 }
 
-func createGoMainFile(projectName string) {
-	sessEnv := strings.ReplaceAll(strings.ToUpper(projectName), "-", "_") + "_COOKIE_STORE_SECRET"
-	dbEnv := strings.ReplaceAll(strings.ToUpper(projectName), "-", "_") + "_DB_PATH"
+// hasWorkerFile reports whether the project was generated with --worker.
+func hasWorkerFile(projectDir string) bool {
+	_, err := os.Stat(filepath.Join(projectDir, filepath.Dir(mainGoFile(projectDir)), "worker.go"))
+	return err == nil
+}
+
+// isTemplProject reports whether the project was generated with
+// --template-engine templ, which keeps its pages next to main.go.
+func isTemplProject(projectDir string) bool {
+	_, err := os.Stat(filepath.Join(projectDir, filepath.Dir(mainGoFile(projectDir)), "layout.templ"))
+	return err == nil
+}
 
-	mainGoTemplate, err := source.ReadFile("source/cmd/main.go")
+// createFileIfNotExists writes content to filePath unless the file is already
+// there, so generators never clobber work in an existing project.
+func createFileIfNotExists(filePath string, content []byte) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		fmt.Println("skipping " + filePath + ", it already exists")
+		return nil
+	}
 	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source main.go file: %w", err))
+		return fmt.Errorf("error creating %s: %w", filePath, err)
 	}
+	defer f.Close()
 
-	mainGoContent := fmt.Sprintf(string(mainGoTemplate), sessEnv, dbEnv)
+	_, err = f.Write(content)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", filePath, err)
+	}
 
-	filePath := filepath.Join(projectName, "cmd", "main.go")
+	return nil
+}
 
-	f, err := os.Create(filePath)
+// insertBeforeMarker adds code to a generated file on the line above marker,
+// unless the file already contains it.
+func insertBeforeMarker(filePath string, marker string, code string) error {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		fmt.Println("error creating main.go file: ", err)
+		return fmt.Errorf("error reading %s: %w", filePath, err)
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(mainGoContent)
-	if err != nil {
-		fmt.Println("error writing main.go content to file: ", err)
+	if strings.Contains(string(content), code) {
+		return nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == marker {
+			lines = append(lines[:i], append([]string{code}, lines[i:]...)...)
+			return os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0644)
+		}
 	}
+
+	return fmt.Errorf("could not find %q in %s, add the following manually:\n%s", marker, filePath, code)
 }
 
-func createHtmlFile(projectName string) {
-	pn := strings.ReplaceAll(projectName, "-", " ")
+func generateUiKit(projectDir string) error {
+	if detectProjectOptions(projectDir).templ {
+		return errors.New("the ui kit is written for html/template, which templ projects do not use")
+	}
 
-	caser := cases.Title(language.English)
-	title := caser.String(pn)
+	componentsDir := filepath.Join(projectDir, "template", "components")
+	err := os.MkdirAll(componentsDir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating components folder: %w", err)
+	}
 
-	indexHTMLTemplate, err := source.ReadFile("source/template/index.html")
+	components, err := source.ReadDir("source/ui-kit/components")
 	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source index.html file: %w", err))
+		return fmt.Errorf("error reading source components: %w", err)
+	}
+
+	for _, component := range components {
+		content, err := source.ReadFile("source/ui-kit/components/" + component.Name())
+		if err != nil {
+			return fmt.Errorf("error reading source %s file: %w", component.Name(), err)
+		}
+
+		err = createFileIfNotExists(filepath.Join(componentsDir, component.Name()), content)
+		if err != nil {
+			return err
+		}
 	}
 
-	indexHTMLContent := fmt.Sprintf(string(indexHTMLTemplate), title, title, title, title)
+	showcaseContent, err := source.ReadFile("source/ui-kit/ui-kit.html")
+	if err != nil {
+		return fmt.Errorf("error reading source ui-kit.html file: %w", err)
+	}
 
-	filePath := filepath.Join(projectName, "template", "index.html")
+	err = createFileIfNotExists(filepath.Join(projectDir, "template", "ui-kit.html"), showcaseContent)
+	if err != nil {
+		return err
+	}
 
-	f, err := os.Create(filePath)
+	cssContent, err := source.ReadFile("source/ui-kit/components.css")
 	if err != nil {
-		fmt.Println("error creating index.html file: ", err)
+		return fmt.Errorf("error reading source components.css file: %w", err)
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(indexHTMLContent)
+	err = createFileIfNotExists(filepath.Join(projectDir, "static", "components.css"), cssContent)
 	if err != nil {
-		fmt.Println("error writing index.html content to file: ", err)
+		return err
 	}
+
+	return insertBeforeMarker(
+		filepath.Join(projectDir, mainGoFile(projectDir)),
+		routesMarker,
+		uiKitRoute,
+	)
 }
 
-func createDashboardHtmlFile(projectName string) {
-	pn := strings.ReplaceAll(projectName, "-", " ")
+const uiKitRoute = `	if cfg.AppEnv != "production" {
+		e.GET("/ui-kit", func(c echo.Context) error {
+			return c.Render(http.StatusOK, "ui-kit", [][]string{
+				{"Name", "Email", "Role"},
+				{"Ada Lovelace", "ada@example.com", "admin"},
+				{"Alan Turing", "alan@example.com", "user"},
+			})
+		})
+	}`
 
-	caser := cases.Title(language.English)
-	title := caser.String(pn)
+func generatePage(projectDir string, pageName string, auth bool) error {
+	if err := checkSourceTemplates(); err != nil {
+		return err
+	}
 
-	dashboardHTMLTemplate, err := source.ReadFile("source/template/dashboard.html")
-	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source dashboard.html file: %w", err))
+	opts := detectProjectOptions(projectDir)
+
+	if auth && opts.minimal {
+		return withExitCode(exitValidation, errors.New("--auth needs the sign in scaffolding, which --minimal projects leave out"))
+	}
+
+	if opts.templ {
+		return generateTemplPage(projectDir, pageName)
 	}
 
-	dashboardHTMLContent := fmt.Sprintf(string(dashboardHTMLTemplate), title)
+	filePath := filepath.Join(projectDir, "template", pageName+".html")
+	if _, err := os.Stat(filePath); err == nil {
+		return withExitCode(exitFilesystem, fmt.Errorf("%s already exists", filePath))
+	}
 
-	filePath := filepath.Join(projectName, "template", "dashboard.html")
+	pn := strings.ReplaceAll(pageName, "-", " ")
 
-	f, err := os.Create(filePath)
+	caser := cases.Title(language.English)
+	title := caser.String(pn)
+
+	// a project that has dropped the shared layout gets a complete page
+	pageTemplate := "source/generate/page.html"
+	if !hasLayout(projectDir) {
+		pageTemplate = "source/generate/standalone-page.html"
+	}
+
+	pageContent, err := executeSourceTemplate(pageTemplate, map[string]string{
+		"Name":  pageName,
+		"Title": title,
+	})
 	if err != nil {
-		fmt.Println("error creating dashboard.html file: ", err)
+		return err
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(dashboardHTMLContent)
+	err = createFileIfNotExists(filePath, []byte(pageContent))
 	if err != nil {
-		fmt.Println("error writing dashboard.html content to file: ", err)
+		return err
+	}
+
+	route := "\te.GET(\"/" + pageName + "\", pageHandler(\"" + pageName + "\"))"
+	if auth {
+		route = "\te.GET(\"/" + pageName + "\", pageHandler(\"" + pageName + "\"), requireAuth)"
 	}
+
+	return insertBeforeMarker(filepath.Join(projectDir, mainGoFile(projectDir)), routesMarker, route)
 }
 
-func createHtmxFile(projectName string) {
-	htmxJsContent, err := source.ReadFile("source/static/htmx.min.js")
+// hasLayout reports whether template/layout.html still defines the layout
+// template pages extend.
+func hasLayout(projectDir string) bool {
+	content, err := os.ReadFile(filepath.Join(projectDir, "template", "layout.html"))
 	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+		return false
 	}
 
-	filePath := filepath.Join(projectName, "static", "htmx.min.js")
+	return strings.Contains(string(content), `define "layout"`)
+}
 
-	f, err := os.Create(filePath)
+// generateTemplPage is generatePage for templ projects, the page is a
+// component named after it, about-us becomes aboutUsPage, in a .templ file
+// next to main.go.
+func generateTemplPage(projectDir string, pageName string) error {
+	filePath := filepath.Join(projectDir, filepath.Dir(mainGoFile(projectDir)), pageName+".templ")
+	if _, err := os.Stat(filePath); err == nil {
+		return withExitCode(exitFilesystem, fmt.Errorf("%s already exists", filePath))
+	}
+
+	words := strings.Split(pageName, "-")
+	caser := cases.Title(language.English)
+	title := caser.String(strings.Join(words, " "))
+	component := words[0] + strings.ReplaceAll(caser.String(strings.Join(words[1:], " ")), " ", "") + "Page"
+
+	pageContent, err := executeSourceTemplate("source/templ/page.templ", map[string]string{
+		"Component":   component,
+		"QuotedTitle": strconv.Quote(title),
+		"Title":       title,
+	})
 	if err != nil {
-		fmt.Println("error creating styles.css file: ", err)
+		return err
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(string(htmxJsContent))
+	err = createFileIfNotExists(filePath, []byte(pageContent))
 	if err != nil {
-		fmt.Println("error writing styles.css content to file: ", err)
+		return err
 	}
+
+	route := "\te.GET(\"/" + pageName + "\", pageHandler(" + component + "()))"
+
+	return insertBeforeMarker(filepath.Join(projectDir, mainGoFile(projectDir)), routesMarker, route)
 }
 
-func createTwColorsFile(projectName string) {
-	cssContent, err := source.ReadFile("source/static/twcolors.min.css")
-	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+// runDoctor prints a pass/fail checklist for the files and env vars a
+// generated project needs, returning false if anything is missing.
+func runDoctor(projectDir string) bool {
+	projectName := filepath.Base(projectDir)
+	healthy := true
+
+	check := func(ok bool, name string, problem string) {
+		if ok {
+			fmt.Println("[pass] " + name)
+			return
+		}
+
+		fmt.Println("[fail] " + name + ": " + problem)
+		healthy = false
 	}
 
-	filePath := filepath.Join(projectName, "static", "twcolors.min.css")
+	opts := detectProjectOptions(projectDir)
+	minimal := opts.minimal
 
-	f, err := os.Create(filePath)
-	if err != nil {
-		fmt.Println("error creating twcolors.min.css file: ", err)
+	templates := []string{
+		filepath.Join("template", "layout.html"),
+		filepath.Join("template", "index.html"),
+		filepath.Join("template", "error.html"),
+	}
+	if opts.templ {
+		mainDir := filepath.Dir(mainGoFile(projectDir))
+		templates = []string{
+			filepath.Join(mainDir, "layout.templ"),
+			filepath.Join(mainDir, "index.templ"),
+			filepath.Join(mainDir, "error.templ"),
+		}
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(string(cssContent))
+	files := append([]string{mainGoFile(projectDir)}, templates...)
+	files = append(files,
+		filepath.Join("static", "htmx.min.js"),
+		filepath.Join("static", "twcolors.min.css"),
+		filepath.Join("static", "styles.css"),
+		".env",
+	)
+	for _, extra := range opts.staticExtras() {
+		files = append(files, filepath.Join("static", extra.file))
+	}
+	if !minimal {
+		files = append(files,
+			filepath.Join("template", "dashboard.html"),
+			filepath.Join("template", "admin.html"),
+			filepath.Join("template", "account.html"),
+			filepath.Join("template", "verify.html"),
+		)
+	}
+	// projects made before locales/ existed do not read it
+	if mainGo, err := os.ReadFile(filepath.Join(projectDir, mainGoFile(projectDir))); err == nil && strings.Contains(string(mainGo), "func loadLocales(") {
+		files = append(files, filepath.Join("locales", "en.json"))
+	}
+
+	for _, file := range files {
+		_, err := os.Stat(filepath.Join(projectDir, file))
+		check(err == nil, file, "file is missing")
+	}
+
+	if minimal {
+		return healthy
+	}
+
+	env, err := godotenv.Read(filepath.Join(projectDir, ".env"))
 	if err != nil {
-		fmt.Println("error writing twcolors.min.css content to file: ", err)
+		env = map[string]string{}
+	}
+
+	for _, key := range requiredEnvKeys(projectName, opts) {
+		check(env[key] != "", key, "not set in .env")
+	}
+
+	if opts.db == "mysql" {
+		return healthy
+	}
+
+	dbEnv := envPrefix(projectName) + "_DB_PATH"
+	dbPath := env[dbEnv]
+	if dbPath == "" {
+		dbPath = strings.ToLower(projectName) + ".db"
+	}
+	if !filepath.IsAbs(dbPath) {
+		dbPath = filepath.Join(projectDir, dbPath)
 	}
+
+	_, err = os.Stat(dbPath)
+	check(err == nil, "database "+filepath.Base(dbPath), "file is missing")
+
+	return healthy
 }
 
-func createCssFile(projectName string) {
-	cssContent, err := source.ReadFile("source/static/styles.css")
-	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source htmx.min.js file: %w", err))
+// requiredEnvKeys are the .env settings a project can not start without,
+// minimal projects have none.
+func requiredEnvKeys(projectName string, opts projectOptions) []string {
+	if opts.minimal {
+		return nil
+	}
+
+	sessEnv := envPrefix(projectName) + "_COOKIE_STORE_SECRET"
+	if opts.db == "mysql" {
+		return []string{"MYSQL_USER", "MYSQL_DATABASE", sessEnv}
 	}
 
-	filePath := filepath.Join(projectName, "static", "styles.css")
+	return []string{envPrefix(projectName) + "_DB_PATH", sessEnv}
+}
+
+const modelsMarker = "// napp:models"
 
-	f, err := os.Create(filePath)
+var modelFieldTypes = map[string]string{
+	"string": "string",
+	"text":   "string",
+	"int":    "int",
+	"float":  "float64",
+	"bool":   "bool",
+}
+
+type modelField struct {
+	Name   string
+	GoName string
+	GoType string
+	Type   string
+	Label  string
+}
+
+// modelSpec holds every spelling of a model name that the model templates
+// need, for example Post, post, posts, Posts and "Blog Post".
+type modelSpec struct {
+	Model     string
+	Var       string
+	VarPlural string
+	Plural    string
+	Name      string
+	Route     string
+	Label     string
+	Title     string
+	Fields    []modelField
+}
+
+func newModelSpec(modelName string, fieldArgs []string) (modelSpec, error) {
+	model := strings.ToUpper(modelName[:1]) + modelName[1:]
+	plural := pluralise(model)
+
+	words := regexp.MustCompile("[A-Z][a-z0-9]*").FindAllString(model, -1)
+	name := strings.ToLower(strings.Join(words, "-"))
+
+	spec := modelSpec{
+		Model:     model,
+		Var:       lowerFirst(model),
+		VarPlural: lowerFirst(plural),
+		Plural:    plural,
+		Name:      name,
+		Route:     pluralise(name),
+		Label:     strings.Join(words, " "),
+		Title:     pluralise(strings.Join(words, " ")),
+	}
+
+	if token.IsKeyword(spec.Var) {
+		spec.Var += "Item"
+	}
+
+	if len(fieldArgs) == 0 {
+		return spec, errors.New("a model needs at least one field, for example: title:string")
+	}
+
+	seen := map[string]bool{}
+	for _, arg := range fieldArgs {
+		fieldName, fieldType, found := strings.Cut(arg, ":")
+		if !found {
+			fieldType = "string"
+		}
+
+		matched, _ := regexp.MatchString("^[a-z][a-z0-9_]*$", fieldName)
+		if !matched {
+			return spec, fmt.Errorf("field name %q must be lowercase letters, numbers and underscores", fieldName)
+		}
+
+		goType, ok := modelFieldTypes[fieldType]
+		if !ok {
+			return spec, fmt.Errorf("field type %q must be one of: string, text, int, float, bool", fieldType)
+		}
+
+		caser := cases.Title(language.English)
+		label := caser.String(strings.ReplaceAll(fieldName, "_", " "))
+		goName := strings.ReplaceAll(label, " ", "")
+
+		switch goName {
+		case "ID", "Id", "CreatedAt", "UpdatedAt", "DeletedAt", "Model":
+			return spec, fmt.Errorf("field name %q is reserved by gorm.Model", fieldName)
+		}
+
+		if seen[goName] {
+			return spec, fmt.Errorf("field %q is defined more than once", fieldName)
+		}
+		seen[goName] = true
+
+		spec.Fields = append(spec.Fields, modelField{
+			Name:   fieldName,
+			GoName: goName,
+			GoType: goType,
+			Type:   fieldType,
+			Label:  label,
+		})
+	}
+
+	return spec, nil
+}
+
+func lowerFirst(s string) string {
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+func pluralise(word string) string {
+	lower := strings.ToLower(word)
+
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return word + "es"
+	case strings.HasSuffix(lower, "y") && !strings.ContainsAny(lower[len(lower)-2:len(lower)-1], "aeiou"):
+		return word[:len(word)-1] + "ies"
+	}
+
+	return word + "s"
+}
+
+// executeGenerateTemplate renders one of the generator templates.
+func executeGenerateTemplate(name string, data interface{}) (string, error) {
+	return executeSourceTemplate("source/generate/"+name, data)
+}
+
+// executeSourceTemplate fills in an embedded source file. They use [[ ]]
+// delimiters so the html/template and templ syntax they contain passes
+// through, and a field missing from a map is an error rather than
+// "<no value>" in the generated file.
+func executeSourceTemplate(path string, data interface{}) (string, error) {
+	content, err := source.ReadFile(path)
 	if err != nil {
-		fmt.Println("error creating styles.css file: ", err)
+		return "", fmt.Errorf("error reading %s: %w", path, err)
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(string(cssContent))
+	tmpl, err := template.New(filepath.Base(path)).
+		Delims("[[", "]]").
+		Funcs(template.FuncMap{"lower": strings.ToLower}).
+		Option("missingkey=error").
+		Parse(string(content))
 	if err != nil {
-		fmt.Println("error writing styles.css content to file: ", err)
+		return "", fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", fmt.Errorf("error executing %s: %w", path, err)
 	}
+
+	return buf.String(), nil
 }
 
-func createIgnoreFile(projectName string) {
-	dbFilename := strings.ToLower(projectName) + ".db"
-	envFilename := ".env"
+var migrationColumnTypes = map[string][2]string{
+	"string": {"text", "longtext"},
+	"text":   {"text", "longtext"},
+	"int":    {"integer", "bigint"},
+	"float":  {"real", "double"},
+	"bool":   {"numeric", "boolean"},
+}
 
-	ignoreTemplate, err := source.ReadFile("source/.gitignore")
-	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source .gitignore file: %w", err))
+type migrationColumn struct {
+	Name string
+	Type string
+}
+
+// createModelMigrationFile writes a migration creating the table for a
+// generated model, with the column types gorm would pick for the database.
+func createModelMigrationFile(projectDir string, spec modelSpec, db string) error {
+	data := struct {
+		Table   string
+		MySQL   bool
+		Columns []migrationColumn
+	}{
+		Table: strings.ReplaceAll(spec.Route, "-", "_"),
+		MySQL: db == "mysql",
 	}
 
-	ignoreContent := fmt.Sprintf(
-		string(ignoreTemplate),
-		envFilename,
-		dbFilename,
-	)
+	for _, field := range spec.Fields {
+		columnType := migrationColumnTypes[field.Type][0]
+		if data.MySQL {
+			columnType = migrationColumnTypes[field.Type][1]
+		}
 
-	filePath := filepath.Join(projectName, ".gitignore")
+		data.Columns = append(data.Columns, migrationColumn{Name: field.Name, Type: columnType})
+	}
 
-	f, err := os.Create(filePath)
+	content, err := executeGenerateTemplate("migration.sql.tmpl", data)
 	if err != nil {
-		fmt.Println("error creating .gitignore file: ", err)
+		return err
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(ignoreContent)
+	fileName := time.Now().Format(migrationVersionFormat) + "_create_" + data.Table + ".sql"
+
+	return createFileIfNotExists(filepath.Join(projectDir, "migrations", fileName), []byte(content))
+}
+
+func generateModel(projectDir string, spec modelSpec) error {
+	mainFilePath := filepath.Join(projectDir, mainGoFile(projectDir))
+
+	mainContent, err := os.ReadFile(mainFilePath)
 	if err != nil {
-		fmt.Println("error writing .gitignore content to file: ", err)
+		return fmt.Errorf("error reading %s: %w", mainFilePath, err)
 	}
-}
 
-func createDotEnvFile(projectName string) {
-	dbEnv := strings.ReplaceAll(strings.ToUpper(projectName), "-", "_")
-	sessEnv := strings.ReplaceAll(strings.ToUpper(projectName), "-", "_")
-	sessSecret := "secret"
-	dbFilename := strings.ToLower(projectName) + ".db"
+	opts := detectProjectOptions(projectDir)
+
+	if !opts.migrations && !strings.Contains(string(mainContent), modelsMarker) {
+		return withExitCode(exitValidation, fmt.Errorf("%s has no database to add models to, was it generated with --minimal?", mainFilePath))
+	}
 
-	dotenvTemplate, err := source.ReadFile("source/.env")
+	if !strings.Contains(string(mainContent), "func paginate(") {
+		return withExitCode(exitValidation, fmt.Errorf("%s is missing the pagination helpers the generated list page uses", mainFilePath))
+	}
+
+	if strings.Contains(string(mainContent), "type "+spec.Model+" struct") {
+		return withExitCode(exitValidation, fmt.Errorf("%s already defines a %s type", mainFilePath, spec.Model))
+	}
+
+	templatePath := filepath.Join(projectDir, "template", spec.Route+".html")
+	formTemplatePath := filepath.Join(projectDir, "template", spec.Route+"-form.html")
+	for _, path := range []string{templatePath, formTemplatePath} {
+		if _, err := os.Stat(path); err == nil {
+			return withExitCode(exitFilesystem, fmt.Errorf("%s already exists", path))
+		}
+	}
+
+	htmlContent, err := executeGenerateTemplate("model.html.tmpl", spec)
 	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source .env file: %w", err))
+		return err
 	}
 
-	dotenvContent := fmt.Sprintf(string(dotenvTemplate), dbEnv, dbFilename, sessEnv, sessSecret)
+	formHtmlContent, err := executeGenerateTemplate("model-form.html.tmpl", spec)
+	if err != nil {
+		return err
+	}
 
-	filePath := filepath.Join(projectName, ".env")
+	goContent, err := executeGenerateTemplate("model.go.tmpl", spec)
+	if err != nil {
+		return err
+	}
 
-	f, err := os.Create(filePath)
+	err = createFileIfNotExists(templatePath, []byte(htmlContent))
 	if err != nil {
-		fmt.Println("error creating .env file: ", err)
+		return err
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(dotenvContent)
+	err = createFileIfNotExists(formTemplatePath, []byte(formHtmlContent))
 	if err != nil {
-		fmt.Println("error writing database content to file: ", err)
+		return err
 	}
-}
 
-func createSqliteDbFile(projectName string) {
-	dbfileName := strings.ToLower(projectName) + ".db"
-	filePath := filepath.Join(projectName, dbfileName)
+	err = os.WriteFile(mainFilePath, append(mainContent, goContent...), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", mainFilePath, err)
+	}
 
-	_, err := os.Create(filePath)
+	if opts.migrations {
+		err = createModelMigrationFile(projectDir, spec, opts.db)
+	} else {
+		err = insertBeforeMarker(mainFilePath, modelsMarker, "\t\t&"+spec.Model+"{},")
+	}
 	if err != nil {
-		fmt.Println("error creating database file: ", err)
+		return err
 	}
-}
 
-func createDockerfile(projectName string) {
-	dockerfileContent, err := source.ReadFile("source/Dockerfile")
+	routes := []string{
+		"\te.GET(\"/" + spec.Route + "\", list" + spec.Plural + "Handler(db))",
+		"\te.GET(\"/" + spec.Route + "/new\", new" + spec.Model + "Handler())",
+		"\te.POST(\"/" + spec.Route + "\", create" + spec.Model + "Handler(db))",
+		"\te.GET(\"/" + spec.Route + "/:id/edit\", edit" + spec.Model + "Handler(db))",
+		"\te.PUT(\"/" + spec.Route + "/:id\", update" + spec.Model + "Handler(db))",
+		"\te.DELETE(\"/" + spec.Route + "/:id\", delete" + spec.Model + "Handler(db))",
+	}
+
+	err = insertBeforeMarker(mainFilePath, routesMarker, strings.Join(routes, "\n"))
 	if err != nil {
-		fmt.Println(fmt.Errorf("error reading source Dockerfile file: %w", err))
+		return err
 	}
 
-	filePath := filepath.Join(projectName, "Dockerfile")
+	return formatGoFile(mainFilePath)
+}
 
-	f, err := os.Create(filePath)
+func formatGoFile(filePath string) error {
+	content, err := os.ReadFile(filePath)
 	if err != nil {
-		fmt.Println("error creating Dockerfile file: ", err)
+		return fmt.Errorf("error reading %s: %w", filePath, err)
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(string(dockerfileContent))
+	formatted, err := format.Source(content)
 	if err != nil {
-		fmt.Println("error writing Dockerfile content to file: ", err)
+		return fmt.Errorf("error formatting %s: %w", filePath, err)
 	}
+
+	return os.WriteFile(filePath, formatted, 0644)
 }
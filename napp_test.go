@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs napp itself when NAPP_TEST_MAIN is set, so tests can call
+// the real command line through the test binary.
+func TestMain(m *testing.M) {
+	if os.Getenv("NAPP_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func runNapp(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	return runNappWithEnv(t, dir, nil, args...)
+}
+
+func runNappWithEnv(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "NAPP_TEST_MAIN=1"), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("napp %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+
+	return string(out)
+}
+
+func TestInitWithExtras(t *testing.T) {
+	for _, extra := range staticExtras {
+		if _, err := fs.Stat(source, "source/extras/"+extra.file); err != nil {
+			t.Skipf("source/extras/%s is not vendored yet, add the %s %s release", extra.file, extra.name, extra.version)
+		}
+	}
+
+	dir := t.TempDir()
+	runNapp(t, dir, "init", "--with", "alpine,hyperscript", "demo")
+
+	layout, err := os.ReadFile(filepath.Join(dir, "demo", "template", "layout.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, extra := range staticExtras {
+		want, err := source.ReadFile("source/extras/" + extra.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(dir, "demo", "static", extra.file))
+		if err != nil {
+			t.Fatalf("%s was not copied to static: %v", extra.file, err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("static/%s does not match the embedded %s %s release", extra.file, extra.name, extra.version)
+		}
+
+		if !strings.Contains(string(layout), `{{ asset "`+extra.file+`" }}`) {
+			t.Errorf("layout does not link %s", extra.file)
+		}
+	}
+}
+
+func TestInitRejectsUnknownExtra(t *testing.T) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "init", "--with", "alpine,jquery", "demo")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "NAPP_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok || exitErr.ExitCode() != exitInvalidArgs {
+		t.Fatalf("want exit %d, got %v\n%s", exitInvalidArgs, err, out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "demo")); !os.IsNotExist(err) {
+		t.Errorf("project directory was created for an invalid --with")
+	}
+}
+
+func TestDryRunHasNoSideEffects(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("/* htmx */"))
+	}))
+	defer server.Close()
+
+	original := htmxDownloadURL
+	htmxDownloadURL = server.URL + "/htmx.org@"
+	defer func() { htmxDownloadURL = original }()
+
+	projectDir := filepath.Join(t.TempDir(), "demo")
+	opts := projectOptions{css: "minimal", db: "sqlite", sessionStore: "cookie", htmxVersion: "1.9.12"}
+
+	var plan bytes.Buffer
+	if err := printProjectPlan(&plan, projectDir, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloads != 0 {
+		t.Errorf("dry run downloaded htmx %d times", downloads)
+	}
+	if !strings.Contains(plan.String(), "htmx.min.js") {
+		t.Errorf("plan does not list htmx.min.js:\n%s", plan.String())
+	}
+	if _, err := os.Stat(projectDir); !os.IsNotExist(err) {
+		t.Errorf("dry run created %s", projectDir)
+	}
+}
+
+func TestDryRunWarnsOnce(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module outer\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scratch copy of the plan is made under TMPDIR, inside the module
+	// too, which must not warn a second time
+	out := runNappWithEnv(t, dir, []string{"TMPDIR=" + dir}, "init", "--dry-run", "--force", "demo")
+	if n := strings.Count(out, "is inside the Go module"); n != 1 {
+		t.Errorf("want the nested module warning once, got %d:\n%s", n, out)
+	}
+}
+
+func TestNoDockerReadmeListsRuntimeDirs(t *testing.T) {
+	dir := t.TempDir()
+	runNapp(t, dir, "init", "--no-docker", "--migrations", "demo")
+
+	readme, err := os.ReadFile(filepath.Join(dir, "demo", "README.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"`static/`", "`template/`", "`locales/`", "`migrations/`", "`.env`"} {
+		if !strings.Contains(string(readme), want) {
+			t.Errorf("README does not tell the app needs %s", want)
+		}
+	}
+}
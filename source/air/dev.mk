@@ -0,0 +1,5 @@
+
+.PHONY: dev
+
+dev:
+	air
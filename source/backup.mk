@@ -0,0 +1,5 @@
+
+.PHONY: backup
+
+backup:
+	go run $(MAIN) backup
@@ -1,378 +1,2906 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base32"
+	"encoding/gob"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	gommonbytes "github.com/labstack/gommon/bytes"
+	gommonlog "github.com/labstack/gommon/log"
+	"golang.org/x/crypto/acme/autocert"
 	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/time/rate"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// Template renders the pages in template/, which each extend layout.html.
+// Every page file gets its own copy of the layout and partials so pages can
+// all define the same title and content blocks without clashing.
 type Template struct {
-	tmpl *template.Template
+	// every locale gets its own copy of the templates, with t looking up
+	// that locale's messages
+	locales map[string]templateSet
+
+	// with reload set every render parses the templates again, so edits show
+	// up without restarting the app
+	fsys   fs.FS
+	reload bool
+}
+
+// assets is where templates and static files are read from. Projects
+// generated with --embed replace it with an embed.FS in embed.go so the
+// binary needs nothing else on disk.
+var assets fs.FS = os.DirFS(".")
+
+type templateSet struct {
+	base  *template.Template
+	pages map[string]*template.Template
+}
+
+// newTemplate parses the layout, partials and pages once for each locale,
+// returning an error that names the file at fault rather than panicking.
+func newTemplate(fsys fs.FS, reload bool) (*Template, error) {
+	partials, pages, err := findTemplates(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := assetVersions(fsys)
+	if err != nil {
+		return nil, errors.New("hashing static files: " + err.Error())
+	}
+
+	locales, err := loadLocales(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Template{
+		locales: map[string]templateSet{},
+		fsys:    fsys,
+		reload:  reload,
+	}
+
+	for locale := range locales {
+		set, err := parseTemplates(fsys, partials, pages, template.FuncMap{
+			"asset": assetURL(versions),
+			"t": func(key string, args ...interface{}) string {
+				return locales.translate(locale, key, args...)
+			},
+			"locale": func() string { return locale },
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		t.locales[locale] = set
+	}
+
+	// every locale parses the same files, so checking one is enough
+	var missing []string
+	for _, name := range requiredTemplates {
+		if _, ok := t.locales[defaultLocale].pages[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("template/ does not define " + strings.Join(missing, ", ") + ", which the app renders")
+	}
+
+	return t, nil
+}
+
+// requiredTemplates are rendered by handlers every project has, so the app
+// refuses to start without them rather than failing those requests.
+var requiredTemplates = []string{"index", "error", "dashboard", "sign-in-form", "sign-up-form"}
+
+func parseTemplates(fsys fs.FS, partials []string, pages []string, funcs template.FuncMap) (templateSet, error) {
+	base, err := template.New("layout.html").
+		Funcs(funcs).
+		ParseFS(fsys, append([]string{"template/layout.html"}, partials...)...)
+	if err != nil {
+		return templateSet{}, errors.New("parsing template/layout.html and partials: " + err.Error())
+	}
+
+	set := templateSet{
+		base:  base,
+		pages: map[string]*template.Template{},
+	}
+
+	for _, page := range pages {
+		layout, err := base.Clone()
+		if err != nil {
+			return set, errors.New("copying layout for " + page + ": " + err.Error())
+		}
+
+		tmpl, err := layout.ParseFS(fsys, page)
+		if err != nil {
+			return set, errors.New("parsing " + page + ": " + err.Error())
+		}
+
+		// anything the page defines that the layout does not, such as the
+		// page itself and its partials, is rendered from this copy
+		for _, defined := range tmpl.Templates() {
+			if base.Lookup(defined.Name()) == nil {
+				set.pages[defined.Name()] = tmpl
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// findTemplates walks template/ for .html files. Files directly inside it
+// are pages, while files in any folder below it, such as template/components,
+// are partials shared by every page. Templates are known by their file name
+// alone, so two files with the same name in different folders are an error.
+func findTemplates(fsys fs.FS) ([]string, []string, error) {
+	var partials, pages []string
+	seen := map[string]string{"layout.html": "template/layout.html"}
+
+	err := fs.WalkDir(fsys, "template", func(path string, d fs.DirEntry, err error) error {
+		if path == "template" && errors.Is(err, fs.ErrNotExist) {
+			return errors.New("template/ is missing, it holds the pages the app renders")
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".html") || path == "template/layout.html" {
+			return err
+		}
+
+		if other, ok := seen[d.Name()]; ok {
+			return errors.New(path + " has the same file name as " + other + ", template file names must be unique")
+		}
+		seen[d.Name()] = path
+
+		if strings.Count(path, "/") == 1 {
+			pages = append(pages, path)
+		} else {
+			partials = append(partials, path)
+		}
+
+		return nil
+	})
+
+	return partials, pages, err
+}
+
+// assetVersions maps each file in static/ to a short hash of its content.
+// They are worked out whenever the templates are parsed, so in production a
+// changed file gets a new URL on the next deploy.
+func assetVersions(fsys fs.FS) (map[string]string, error) {
+	versions := map[string]string{}
+
+	err := fs.WalkDir(fsys, "static", func(path string, d fs.DirEntry, err error) error {
+		if path == "static" && errors.Is(err, fs.ErrNotExist) {
+			return errors.New("static/ is missing, it holds the stylesheets and scripts the pages use")
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		versions[strings.TrimPrefix(path, "static/")] = hex.EncodeToString(sum[:])[:12]
+
+		return nil
+	})
+
+	return versions, err
+}
+
+// assetURL backs the asset template function, {{ asset "styles.css" }}
+// becomes /static/styles.css?v=<hash> so browsers fetch the file again once
+// its content changes. Naming a file that does not exist fails the render.
+func assetURL(versions map[string]string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		version, ok := versions[name]
+		if !ok {
+			return "", errors.New("asset: no file named " + name + " in static/")
+		}
+
+		return "/static/" + name + "?v=" + version, nil
+	}
+}
+
+// defaultLocale is used when a request asks for no language the app has
+// messages for, and for any message another locale leaves out.
+const defaultLocale = "en"
+
+// localeKey is where resolveLocale leaves the request's locale in the echo
+// context.
+const localeKey = "locale"
+
+// Locales holds the messages in locales/, keyed by the language each file is
+// named after, such as "en" or "pt-br", and then by message key.
+type Locales map[string]map[string]string
+
+// loadLocales reads every .json file in locales/, so translating the app is
+// a matter of copying en.json and translating the messages in it.
+func loadLocales(fsys fs.FS) (Locales, error) {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	locales := Locales{}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, errors.New("reading " + file + ": " + err.Error())
+		}
+
+		messages := map[string]string{}
+		if err := json.Unmarshal(content, &messages); err != nil {
+			return nil, errors.New("parsing " + file + ": " + err.Error())
+		}
+
+		locales[strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))] = messages
+	}
+
+	if _, ok := locales[defaultLocale]; !ok {
+		return nil, errors.New("locales/" + defaultLocale + ".json is missing")
+	}
+
+	return locales, nil
+}
+
+// match picks the locale for an Accept-Language header. Languages are tried
+// in order of preference, each as given and then without its region, so
+// "pt-BR" is served pt.json when there is no pt-br.json.
+func (l Locales) match(acceptLanguage string) string {
+	type preference struct {
+		tag     string
+		quality float64
+	}
+
+	var preferences []preference
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		if tag != "" && quality > 0 {
+			preferences = append(preferences, preference{tag, quality})
+		}
+	}
+
+	sort.SliceStable(preferences, func(i, j int) bool {
+		return preferences[i].quality > preferences[j].quality
+	})
+
+	for _, p := range preferences {
+		if _, ok := l[p.tag]; ok {
+			return p.tag
+		}
+
+		language, _, _ := strings.Cut(p.tag, "-")
+		if _, ok := l[language]; ok {
+			return language
+		}
+	}
+
+	return defaultLocale
+}
+
+// translate looks key up in locale, falling back to the default locale and
+// then the key itself, so a missing message is obvious rather than blank.
+// Any args fill in the message's fmt verbs.
+func (l Locales) translate(locale string, key string, args ...interface{}) string {
+	message, ok := l[locale][key]
+	if !ok {
+		message, ok = l[defaultLocale][key]
+	}
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+
+	return message
+}
+
+// resolveLocale picks each request's locale from its Accept-Language header
+// for translate and the templates' t function.
+func resolveLocale(locales Locales) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			locale := locales.match(c.Request().Header.Get("Accept-Language"))
+			c.Set(localeKey, locale)
+			c.Set("locales", locales)
+
+			c.Response().Header().Set("Content-Language", locale)
+			c.Response().Header().Add(echo.HeaderVary, "Accept-Language")
+
+			return next(c)
+		}
+	}
+}
+
+// translate returns the message for key in the request's locale.
+func translate(c echo.Context, key string, args ...interface{}) string {
+	locales, _ := c.Get("locales").(Locales)
+	if locales == nil {
+		return key
+	}
+
+	locale, _ := c.Get(localeKey).(string)
+	return locales.translate(locale, key, args...)
+}
+
+// Render executes the named template into a buffer before anything is written
+// to the response, so a failing template results in a clean 500 rather than
+// a half-rendered page sent with the handler's status code.
+//
+// Pages are given their data as an echo.Map, or nil when they need none, and
+// Render adds the signed in user to it as CurrentUser. Partials rendered with
+// anything else, like FormData, are passed through untouched.
+func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	if t.reload {
+		fresh, err := newTemplate(t.fsys, true)
+		if err != nil {
+			return echo.NewHTTPError(
+				http.StatusInternalServerError,
+				"error parsing templates",
+			).SetInternal(err)
+		}
+
+		t = fresh
+	}
+
+	locale, _ := c.Get(localeKey).(string)
+	set, ok := t.locales[locale]
+	if !ok {
+		set = t.locales[defaultLocale]
+	}
+
+	tmpl, ok := set.pages[name]
+	if !ok {
+		tmpl = set.base
+	}
+
+	if values, ok := data.(echo.Map); ok || data == nil {
+		page := echo.Map{"CurrentUser": getCurrentUser(c)}
+		for key, value := range values {
+			page[key] = value
+		}
+
+		data = page
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return echo.NewHTTPError(
+			http.StatusInternalServerError,
+			"error rendering template "+name,
+		).SetInternal(err)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func main() {
+	err := loadEnvFiles()
+	if err != nil {
+		log.Fatal("error loading .env files: ", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(healthcheck(cfg))
+	}
+
+	db, err := gorm.Open(sqlite.Open(cfg.DatabaseDSN), &gorm.Config{
+		TranslateError: true,
+	})
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	err = configurePool(db)
+	if err != nil {
+		log.Fatal("error configuring database pool: ", err)
+	}
+
+	models := []interface{}{
+		&Lead{},
+		&User{},
+		&AuthEvent{},
+		// napp:models
+	}
+
+	cookieStore := sessions.NewCookieStore(cfg.SessionSecret)
+	cookieStore.Options = cfg.sessionOptions()
+	cookieStore.MaxAge(cfg.rememberMeMaxAge())
+
+	var store sessions.Store = cookieStore
+
+	useDBSessions := cfg.SessionStore == "db"
+	if useDBSessions {
+		models = append(models, &Session{})
+		store = newDBStore(db, cfg.sessionOptions(), cfg.SessionSecret)
+	}
+
+	err = migrate(db, migrationTimeout, models...)
+	if err != nil {
+		log.Fatal("error migrating database: ", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		err = seed(db, cfg.SeedAdminPassword, cfg.BcryptCost)
+		if err != nil {
+			log.Fatal("error seeding database: ", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "backup" {
+		file := path.Join("backups", time.Now().UTC().Format(backupTimeLayout)+".db")
+		if len(os.Args) > 2 {
+			file = os.Args[2]
+		}
+
+		err = os.MkdirAll(path.Dir(file), 0755)
+		if err == nil {
+			err = backupDatabase(db, file)
+		}
+		if err != nil {
+			log.Fatal("error backing up database: ", err)
+		}
+		fmt.Println("backed up the database to " + file)
+		return
+	}
+
+	e, err := newServer(cfg, db, store)
+	if err != nil {
+		log.Fatal("error loading templates: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := newScheduler()
+	if cfg.InactiveUserDays > 0 || cfg.UnverifiedUserDays > 0 {
+		jobs.every(
+			inactiveUserCleanupInterval,
+			"inactive user cleanup",
+			cleanupInactiveUsers(
+				db,
+				time.Duration(cfg.InactiveUserDays)*24*time.Hour,
+				time.Duration(cfg.UnverifiedUserDays)*24*time.Hour,
+				cfg.InactiveUserAction,
+			),
+		)
+	}
+	if useDBSessions {
+		jobs.every(expiredSessionCleanupInterval, "expired session cleanup", cleanupExpiredSessions(db))
+	}
+
+	go func() {
+		if err := startServer(e, cfg); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal("shutting down the server: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// Background jobs are drained first so they can still use the database,
+	// then the server stops taking requests and finally the database closes.
+	if err := jobs.stop(shutdownTimeout); err != nil {
+		fmt.Println("error stopping background jobs: ", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("error shutting down server: ", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err == nil {
+		if err := sqlDB.Close(); err != nil {
+			fmt.Println("error closing database: ", err)
+		}
+	}
+}
+
+// newServer sets up the middleware and routes, it is kept separate from main
+// so tests can run the app against their own config, database and session
+// store.
+func newServer(cfg Config, db *gorm.DB, store sessions.Store) (*echo.Echo, error) {
+	e := echo.New()
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
+	e.Server.IdleTimeout = cfg.IdleTimeout
+	e.TLSServer.ReadTimeout = cfg.ReadTimeout
+	e.TLSServer.WriteTimeout = cfg.WriteTimeout
+	e.TLSServer.IdleTimeout = cfg.IdleTimeout
+	e.Logger.SetLevel(logLevels[cfg.LogLevel])
+	e.IPExtractor = cfg.ipExtractor()
+	e.HTTPErrorHandler = errorHandler
+	e.Validator = newFormValidator()
+	renderer, err := newTemplate(assets, cfg.ReloadTemplates)
+	if err != nil {
+		return nil, err
+	}
+	e.Renderer = renderer
+	locales, err := loadLocales(assets)
+	if err != nil {
+		return nil, err
+	}
+	staticCache := cacheStatic(cfg.StaticMaxAge, cfg.UnversionedMaxAge)
+	e.GET("/static/*", echo.StaticDirectoryHandler(echo.MustSubFS(assets, "static"), false), staticCache)
+	// browsers and crawlers ask for /favicon.ico whatever the layout links to
+	e.FileFS("/favicon.ico", "static/favicon.ico", assets, staticCache)
+	e.Use(middleware.Recover())
+	e.Use(resolveLocale(locales))
+	if cfg.Gzip {
+		e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+			Skipper:   skipGzip,
+			MinLength: 1024,
+		}))
+	}
+	e.Use(middleware.BodyLimit(cfg.BodyLimit))
+	e.Use(middleware.Secure())
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format: "method=${method}, uri=${uri}, status=${status}\n",
+	}))
+	// Double-submit CSRF protection: the token cookie is readable by JavaScript
+	// and must be echoed back in the X-CSRF-Token header on every POST, PUT,
+	// PATCH and DELETE request.
+	e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "header:" + echo.HeaderXCSRFToken,
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieHTTPOnly: false,
+		CookieSecure:   cfg.SecureCookies,
+		CookieSameSite: http.SameSiteStrictMode,
+	}))
+	e.Use(session.Middleware(store))
+	e.Use(loadCurrentUser(db))
+
+	data := newGormStore(db)
+
+	e.GET("/", homepageHandler())
+	e.POST("/join-waitlist", joinWaitlistHandler(data))
+	e.GET("/auth/sign-in", signIn())
+	authLimiter := newAuthRateLimiter(cfg.AuthRateLimit)
+	signInHandler := signInWithEmailAndPassword(data, cfg.rememberMeMaxAge(), cfg.BcryptCost)
+	e.POST("/auth/sign-in", signInHandler, authLimiter)
+	e.GET("/auth/sign-up", signUp())
+	mailer := newMailer(cfg.Mail)
+	signUpHandler := signUpWithEmailAndPassword(data, mailer, cfg.AppURL, cfg.rememberMeMaxAge(), cfg.BcryptCost)
+	e.POST("/auth/sign-up", signUpHandler, authLimiter)
+	e.POST("/auth/sign-out", signOut(data), authLimiter)
+	// the same handlers answer with JSON under /api for non-HTMX clients
+	e.POST("/api/auth/sign-in", signInHandler, authLimiter)
+	e.POST("/api/auth/sign-up", signUpHandler, authLimiter)
+	e.POST("/api/auth/sign-out", signOut(data), authLimiter)
+	e.GET("/api/auth/me", currentUserHandler())
+	e.GET("/auth/verify", verifyEmailHandler(db))
+	e.GET("/auth/unverified", unverifiedHandler(db))
+	e.POST("/auth/verify/resend", resendVerificationHandler(db, mailer, cfg.AppURL), authLimiter)
+	e.GET("/dashboard", dashboardHandler(), requireAuth)
+	e.GET("/admin", adminHandler(data), requireRole("admin"))
+	e.GET("/admin/events", authEventsHandler(db), requireRole("admin"))
+	e.GET("/admin/users", adminUsersHandler(db), requireRole("admin"))
+	e.POST("/admin/users/:id/deactivate", deactivateUserHandler(db), requireRole("admin"))
+	e.POST("/admin/users/:id/reactivate", reactivateUserHandler(db), requireRole("admin"))
+	e.GET("/admin/backup", backupHandler(db), requireRole("admin"))
+	e.GET("/account/password", accountPasswordHandler(), requireAuth)
+	e.POST("/account/password", changePasswordHandler(data, cfg.BcryptCost), requireAuth)
+	e.GET("/healthz", healthzHandler(db))
+	// napp:routes
+
+	return e, nil
+}
+
+const (
+	sessionSecretEnv = "[[.SessionEnv]]"
+	databasePathEnv  = "[[.DatabaseEnv]]"
+)
+
+const (
+	defaultAuthRateLimit  = 10
+	defaultRememberMeDays = 30
+	defaultBcryptCost     = 10
+	defaultBodyLimit      = "2M"
+	defaultReadTimeout    = 10 * time.Second
+	defaultWriteTimeout   = 30 * time.Second
+	defaultIdleTimeout    = 2 * time.Minute
+	defaultCertCacheDir   = "certs"
+)
+
+// how long static files are cached for outside development
+const (
+	defaultStaticMaxAge      = 365 * 24 * time.Hour
+	defaultUnversionedMaxAge = time.Hour
+)
+
+// Config holds every setting the app reads from the environment. It is
+// loaded once at startup so a missing or malformed value stops the app
+// before it serves a single request.
+type Config struct {
+	DatabaseDSN        string
+	SessionSecret      []byte
+	SessionStore       string
+	Host               string
+	Port               string
+	BodyLimit          string
+	ReadTimeout        time.Duration
+	WriteTimeout       time.Duration
+	IdleTimeout        time.Duration
+	LogLevel           string
+	AppEnv             string
+	AppURL             string
+	Domain             string
+	CertCacheDir       string
+	TrustedProxies     []*net.IPNet
+	StaticMaxAge       time.Duration
+	UnversionedMaxAge  time.Duration
+	ReloadTemplates    bool
+	SecureCookies      bool
+	Gzip               bool
+	AuthRateLimit      int
+	BcryptCost         int
+	RememberMeDays     int
+	InactiveUserDays   int
+	UnverifiedUserDays int
+	InactiveUserAction string
+	SeedAdminPassword  string
+	Mail               MailConfig
+}
+
+// MailConfig picks the mail backend, the SMTP fields are only used when
+// Backend is "smtp".
+type MailConfig struct {
+	Backend      string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+var logLevels = map[string]gommonlog.Lvl{
+	"debug": gommonlog.DEBUG,
+	"info":  gommonlog.INFO,
+	"warn":  gommonlog.WARN,
+	"error": gommonlog.ERROR,
+	"off":   gommonlog.OFF,
+}
+
+// loadConfig reads the environment, filling in defaults for anything
+// optional, and reports every invalid setting at once rather than just the
+// first.
+func loadConfig() (Config, error) {
+	var errs []error
+
+	cfg := Config{
+		SessionSecret:      []byte(os.Getenv(sessionSecretEnv)),
+		SessionStore:       envOr("SESSION_STORE", "cookie"),
+		Host:               os.Getenv("HOST"),
+		Port:               envOr("PORT", "8080"),
+		BodyLimit:          envOr("BODY_LIMIT", defaultBodyLimit),
+		LogLevel:           strings.ToLower(envOr("LOG_LEVEL", "info")),
+		AppEnv:             envOr("APP_ENV", "development"),
+		AppURL:             strings.TrimSuffix(os.Getenv("APP_URL"), "/"),
+		Domain:             os.Getenv("DOMAIN"),
+		CertCacheDir:       envOr("CERT_CACHE_DIR", defaultCertCacheDir),
+		InactiveUserAction: envOr("INACTIVE_USER_ACTION", "flag"),
+		SeedAdminPassword:  envOr("SEED_ADMIN_PASSWORD", defaultSeedAdminPassword),
+		Mail: MailConfig{
+			Backend:      envOr("MAIL_BACKEND", "log"),
+			From:         os.Getenv("MAIL_FROM"),
+			SMTPHost:     os.Getenv("SMTP_HOST"),
+			SMTPPort:     os.Getenv("SMTP_PORT"),
+			SMTPUsername: os.Getenv("SMTP_USERNAME"),
+			SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		},
+	}
+
+	reload, err := boolEnv("RELOAD_TEMPLATES", cfg.AppEnv == "development")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.ReloadTemplates = reload
+
+	secure, err := boolEnv("HTTPS", cfg.AppEnv == "production")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.SecureCookies = secure
+
+	gzip, err := boolEnv("GZIP", true)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.Gzip = gzip
+
+	dsn, err := databaseDSN()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.DatabaseDSN = dsn
+
+	proxies, err := cidrListEnv("TRUSTED_PROXIES")
+	if err != nil {
+		errs = append(errs, err)
+	}
+	cfg.TrustedProxies = proxies
+
+	if _, err := gommonbytes.Parse(cfg.BodyLimit); err != nil {
+		errs = append(errs, errors.New("BODY_LIMIT must be a size such as 512K or 2M, got "+strconv.Quote(cfg.BodyLimit)))
+	}
+
+	// static files are checked with the server on every request in
+	// development, so edits show up without a hard refresh
+	staticMaxAge, unversionedMaxAge := defaultStaticMaxAge, defaultUnversionedMaxAge
+	if cfg.AppEnv == "development" {
+		staticMaxAge, unversionedMaxAge = 0, 0
+	}
+
+	durations := []struct {
+		key      string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"READ_TIMEOUT", &cfg.ReadTimeout, defaultReadTimeout},
+		{"WRITE_TIMEOUT", &cfg.WriteTimeout, defaultWriteTimeout},
+		{"IDLE_TIMEOUT", &cfg.IdleTimeout, defaultIdleTimeout},
+		{"STATIC_MAX_AGE", &cfg.StaticMaxAge, staticMaxAge},
+		{"STATIC_UNVERSIONED_MAX_AGE", &cfg.UnversionedMaxAge, unversionedMaxAge},
+	}
+	for _, d := range durations {
+		value, err := durationEnv(d.key, d.fallback)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		*d.value = value
+	}
+
+	if len(cfg.SessionSecret) == 0 {
+		errs = append(errs, errors.New(sessionSecretEnv+" must be set"))
+	}
+
+	// links in emails are built from APP_URL rather than the Host header of
+	// the request, which the client picks
+	if cfg.AppURL == "" {
+		errs = append(errs, errors.New("APP_URL must be set to the address the app is reached at, such as http://localhost:8080"))
+	} else if u, err := url.Parse(cfg.AppURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("APP_URL must be an http or https address such as https://example.com, got "+strconv.Quote(cfg.AppURL)))
+	}
+
+	if cfg.SessionStore != "cookie" && cfg.SessionStore != "db" {
+		errs = append(errs, errors.New("SESSION_STORE must be cookie or db, got "+strconv.Quote(cfg.SessionStore)))
+	}
+
+	if _, ok := logLevels[cfg.LogLevel]; !ok {
+		errs = append(errs, errors.New("LOG_LEVEL must be debug, info, warn, error or off, got "+strconv.Quote(cfg.LogLevel)))
+	}
+
+	if cfg.InactiveUserAction != "flag" && cfg.InactiveUserAction != "delete" {
+		errs = append(errs, errors.New("INACTIVE_USER_ACTION must be flag or delete, got "+strconv.Quote(cfg.InactiveUserAction)))
+	}
+
+	if cfg.Mail.Backend != "log" && cfg.Mail.Backend != "smtp" {
+		errs = append(errs, errors.New("MAIL_BACKEND must be log or smtp, got "+strconv.Quote(cfg.Mail.Backend)))
+	}
+
+	if cfg.Mail.Backend == "smtp" && (cfg.Mail.SMTPHost == "" || cfg.Mail.From == "") {
+		errs = append(errs, errors.New("SMTP_HOST and MAIL_FROM must be set when MAIL_BACKEND is smtp"))
+	}
+
+	ints := []struct {
+		key      string
+		value    *int
+		fallback int
+		min      int
+	}{
+		{"AUTH_RATE_LIMIT", &cfg.AuthRateLimit, defaultAuthRateLimit, 1},
+		{"REMEMBER_ME_DAYS", &cfg.RememberMeDays, defaultRememberMeDays, 1},
+		{"BCRYPT_COST", &cfg.BcryptCost, defaultBcryptCost, bcrypt.MinCost},
+		{"INACTIVE_USER_DAYS", &cfg.InactiveUserDays, 0, 0},
+		{"UNVERIFIED_USER_DAYS", &cfg.UnverifiedUserDays, 0, 0},
+	}
+	for _, i := range ints {
+		*i.value = i.fallback
+
+		raw := os.Getenv(i.key)
+		if raw == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < i.min {
+			errs = append(errs, errors.New(i.key+" must be a whole number of at least "+strconv.Itoa(i.min)+", got "+strconv.Quote(raw)))
+			continue
+		}
+
+		*i.value = n
+	}
+
+	if cfg.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, errors.New("BCRYPT_COST must be at most "+strconv.Itoa(bcrypt.MaxCost)+", got "+strconv.Itoa(cfg.BcryptCost)))
+	}
+
+	return cfg, errors.Join(errs...)
+}
+
+// loadEnvFiles copies settings from the .env files into the environment.
+// .env.local and then .env.<APP_ENV>, such as .env.production, take priority
+// over .env, and variables already set in the real environment win over all
+// of them. Missing files are skipped, in production everything may come from
+// the real environment.
+func loadEnvFiles() error {
+	appEnv := os.Getenv("APP_ENV")
+	if appEnv == "" {
+		base, err := godotenv.Read(".env")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New(".env: " + err.Error())
+		}
+		appEnv = base["APP_ENV"]
+	}
+	if appEnv == "" {
+		appEnv = "development"
+	}
+
+	// godotenv never overwrites a variable that is already set, so the files
+	// are loaded from the highest priority down
+	for _, name := range []string{".env.local", ".env." + appEnv, ".env"} {
+		err := godotenv.Load(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New(name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// boolEnv reads a true or false setting, falling back when it is unset.
+func boolEnv(key string, fallback bool) (bool, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback, errors.New(key + " must be true or false, got " + strconv.Quote(raw))
+	}
+
+	return value, nil
+}
+
+// durationEnv reads a setting such as 30s or 2m, falling back when it is
+// unset. Zero turns the timeout off.
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		return fallback, errors.New(key + " must be a duration such as 30s or 2m, got " + strconv.Quote(raw))
+	}
+
+	return value, nil
+}
+
+// cidrListEnv reads a comma separated list of CIDR ranges such as
+// 10.0.0.0/8, a plain IP is taken as a range of just that address.
+func cidrListEnv(key string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(part); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, errors.New(key + " must be CIDR ranges such as 10.0.0.0/8, separated by commas, got " + strconv.Quote(part))
+		}
+		ranges = append(ranges, ipNet)
+	}
+
+	return ranges, nil
+}
+
+// rememberMeMaxAge is how long, in seconds, a sign in lasts when remember me
+// is ticked.
+func (cfg Config) rememberMeMaxAge() int {
+	return cfg.RememberMeDays * 86400
+}
+
+// sessionOptions are the cookie settings every session starts with. Secure
+// cookies are only sent over HTTPS, so they are left off in development
+// where the app is served over plain HTTP on localhost.
+func (cfg Config) sessionOptions() *sessions.Options {
+	return &sessions.Options{
+		Path:     "/",
+		MaxAge:   cfg.rememberMeMaxAge(),
+		HttpOnly: true,
+		Secure:   cfg.SecureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// listenAddr joins HOST and PORT, an empty HOST listens on every interface
+// while HOST=127.0.0.1 keeps the app local to the machine.
+func (cfg Config) listenAddr() string {
+	return net.JoinHostPort(cfg.Host, cfg.Port)
+}
+
+const (
+	httpPort  = "80"
+	httpsPort = "443"
+)
+
+// autoTLS is on when DOMAIN is set in production, the app then serves HTTPS
+// itself with certificates from Let's Encrypt instead of HTTP on PORT.
+func (cfg Config) autoTLS() bool {
+	return cfg.Domain != "" && cfg.AppEnv == "production"
+}
+
+// startServer serves plain HTTP on PORT, or with autoTLS HTTPS on 443. The
+// certificates are cached in CERT_CACHE_DIR so restarts do not ask Let's
+// Encrypt for new ones, and port 80 answers its challenges and redirects
+// everything else to HTTPS.
+func startServer(e *echo.Echo, cfg Config) error {
+	if !cfg.autoTLS() {
+		return e.Start(cfg.listenAddr())
+	}
+
+	e.AutoTLSManager.HostPolicy = autocert.HostWhitelist(cfg.Domain)
+	e.AutoTLSManager.Cache = autocert.DirCache(cfg.CertCacheDir)
+
+	redirect := &http.Server{
+		Addr:        net.JoinHostPort(cfg.Host, httpPort),
+		Handler:     e.AutoTLSManager.HTTPHandler(nil),
+		ReadTimeout: cfg.ReadTimeout,
+	}
+	e.TLSServer.RegisterOnShutdown(func() { redirect.Close() })
+
+	go func() {
+		if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			e.Logger.Error("serving the HTTPS redirect: ", err)
+		}
+	}()
+
+	return e.StartAutoTLS(net.JoinHostPort(cfg.Host, httpsPort))
+}
+
+// ipExtractor decides where c.RealIP, and so the auth rate limiter and the
+// auth event log, finds the client's address. Any client can send
+// X-Forwarded-For, so it is only read when the connection comes from one of
+// the TRUSTED_PROXIES, such as a load balancer, and otherwise the address of
+// the connection itself is used.
+func (cfg Config) ipExtractor() echo.IPExtractor {
+	if len(cfg.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// echo trusts loopback and private addresses unless told otherwise
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipNet := range cfg.TrustedProxies {
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// newAuthRateLimiter allows each IP perMinute auth attempts a minute,
+// anything over that gets a 429 so passwords can not be brute forced.
+func newAuthRateLimiter(perMinute int) echo.MiddlewareFunc {
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:      rate.Limit(float64(perMinute) / 60),
+			Burst:     perMinute,
+			ExpiresIn: 3 * time.Minute,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			return c.RealIP(), nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			return echo.NewHTTPError(http.StatusTooManyRequests, translate(c, "auth.rate_limited"))
+		},
+	})
+}
+
+// healthcheck lets the binary probe its own /healthz endpoint, which is what
+// the Dockerfile HEALTHCHECK runs as the distroless image has no curl.
+func healthcheck(cfg Config) int {
+	client := http.Client{Timeout: 5 * time.Second}
+
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	url := "http://" + net.JoinHostPort(host, cfg.Port) + "/healthz"
+	if cfg.autoTLS() {
+		// the certificate is for DOMAIN rather than localhost
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{ServerName: cfg.Domain}}
+		url = "https://" + net.JoinHostPort(host, httpsPort) + "/healthz"
+	}
+
+	res, err := client.Get(url)
+	if err != nil {
+		fmt.Println("healthcheck failed: ", err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Println("healthcheck failed with status: ", res.StatusCode)
+		return 1
+	}
+
+	return 0
+}
+
+const (
+	dbMaxOpenConns    = 10
+	dbMaxIdleConns    = 5
+	dbConnMaxLifetime = time.Hour
+)
+
+// databaseDSN turns on WAL so reads are not blocked by a write, waits up to 5s
+// for a lock rather than failing with "database is locked", and starts every
+// transaction as a writer so two of them can not deadlock upgrading a lock.
+func databaseDSN() (string, error) {
+	path := os.Getenv(databasePathEnv)
+	if path == "" {
+		return "", errors.New(databasePathEnv + " must be set")
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	return path + separator + "_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", nil
+}
+
+func configurePool(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	sqlDB.SetMaxOpenConns(dbMaxOpenConns)
+	sqlDB.SetMaxIdleConns(dbMaxIdleConns)
+	sqlDB.SetConnMaxLifetime(dbConnMaxLifetime)
+
+	return nil
+}
+
+func healthzHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := db.Exec("SELECT 1").Error; err != nil {
+			fmt.Println("error pinging database: ", err)
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"status": "unavailable",
+			})
+		}
+
+		return c.JSON(http.StatusOK, map[string]string{
+			"status": "ok",
+		})
+	}
+}
+
+const (
+	migrationTimeout              = 30 * time.Second
+	shutdownTimeout               = 10 * time.Second
+	inactiveUserCleanupInterval   = time.Hour
+	expiredSessionCleanupInterval = time.Hour
+)
+
+// scheduler runs background jobs on a fixed interval until it is stopped.
+type scheduler struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newScheduler() *scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &scheduler{
+		ctx:      ctx,
+		cancel:   cancel,
+		stopping: make(chan struct{}),
+	}
+}
+
+func (s *scheduler) every(interval time.Duration, name string, job func(context.Context) error) {
+	s.wg.Add(1)
+
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stopping:
+				return
+			case <-ticker.C:
+				select {
+				case <-s.stopping:
+					return
+				default:
+				}
+
+				if err := job(s.ctx); err != nil {
+					log.Println("error running " + name + " job: " + err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// stop prevents any new job runs and waits for running jobs to finish. Jobs
+// still running after the timeout have their context cancelled.
+func (s *scheduler) stop(timeout time.Duration) error {
+	close(s.stopping)
+	defer s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return errors.New("background jobs did not finish within " + timeout.String())
+	}
+}
+
+// cleanupInactiveUsers flags, or soft deletes when action is "delete", users
+// who have not signed in for inactiveFor, or who have not verified their
+// email within unverifiedFor of signing up. Users who have never signed in are
+// judged by when they signed up, a zero duration turns that check off, and
+// admins are always left alone.
+func cleanupInactiveUsers(db *gorm.DB, inactiveFor time.Duration, unverifiedFor time.Duration, action string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		var conditions []string
+		var args []interface{}
+		if inactiveFor > 0 {
+			cutoff := time.Now().Add(-inactiveFor)
+			conditions = append(conditions, "(last_login_at IS NULL AND created_at < ?) OR last_login_at < ?")
+			args = append(args, cutoff, cutoff)
+		}
+		if unverifiedFor > 0 {
+			verifyCutoff := time.Now().Add(-unverifiedFor)
+			conditions = append(conditions, "(email_verified = ? AND created_at < ?)")
+			args = append(args, false, verifyCutoff)
+		}
+		if len(conditions) == 0 {
+			return nil
+		}
+
+		query := db.WithContext(ctx).
+			Where("("+strings.Join(conditions, " OR ")+")", args...).
+			Where("role <> ?", "admin")
+
+		var result *gorm.DB
+		if action == "delete" {
+			result = query.Delete(&User{})
+		} else {
+			action = "flag"
+			result = query.Model(&User{}).
+				Where("flagged_inactive_at IS NULL").
+				Update("flagged_inactive_at", time.Now())
+		}
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		log.Println("inactive user cleanup: " + action + " " + strconv.FormatInt(result.RowsAffected, 10) + " users")
+
+		return nil
+	}
+}
+
+const (
+	seedAdminEmail           = "admin@example.com"
+	defaultSeedAdminPassword = "napp-admin"
+)
+
+// seed fills a development database with an admin user and a few leads,
+// anything that already exists is skipped so it is safe to run again.
+func seed(db *gorm.DB, password string, bcryptCost int) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	admin := newUser("Admin", seedAdminEmail, string(hash), "admin")
+	admin.EmailVerified = true
+	result := db.Where(User{Email: seedAdminEmail}).FirstOrCreate(&admin)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		fmt.Println("created admin user " + seedAdminEmail + " with password " + password)
+	} else {
+		fmt.Println("skipping admin user " + seedAdminEmail + ", it already exists")
+	}
+
+	created := 0
+	for _, email := range []string{"ada@example.com", "alan@example.com", "grace@example.com"} {
+		lead := Lead{Email: email}
+		result := db.Where(Lead{Email: email}).FirstOrCreate(&lead)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		created += int(result.RowsAffected)
+	}
+
+	fmt.Println("created " + strconv.Itoa(created) + " sample leads")
+
+	return nil
+}
+
+// migrate runs AutoMigrate for each model in turn, giving up once the timeout
+// has elapsed so a locked database fails startup rather than hanging it.
+func migrate(db *gorm.DB, timeout time.Duration, models ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		for _, model := range models {
+			name := reflect.Indirect(reflect.ValueOf(model)).Type().Name()
+			fmt.Println("migrating " + name)
+
+			if err := db.WithContext(ctx).AutoMigrate(model); err != nil {
+				done <- errors.New("migrating " + name + ": " + err.Error())
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return errors.New("migration did not complete within " + timeout.String())
+	}
+}
+
+func homepageHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, "index", echo.Map{
+			"LeadForm": newFormData(),
+			"Flashes":  getFlashes(c),
+		})
+	}
+}
+
+// addFlash queues a message for the next page that renders flashes, which is
+// how feedback survives a redirect.
+func addFlash(c echo.Context, msg string) {
+	sess, _ := session.Get("flash", c)
+	sess.AddFlash(msg)
+
+	err := sess.Save(c.Request(), c.Response())
+	if err != nil {
+		fmt.Println("error saving flash: ", err)
+	}
+}
+
+// getFlashes returns any queued messages and clears them so each one is only
+// shown once.
+func getFlashes(c echo.Context) []string {
+	sess, _ := session.Get("flash", c)
+
+	flashes := sess.Flashes()
+	if len(flashes) == 0 {
+		return nil
+	}
+
+	err := sess.Save(c.Request(), c.Response())
+	if err != nil {
+		fmt.Println("error saving flash: ", err)
+	}
+
+	messages := make([]string, 0, len(flashes))
+	for _, flash := range flashes {
+		if msg, ok := flash.(string); ok {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+// currentUser returns the signed in user, or nil when there is no session.
+// A session that can not be decoded is cleared and treated as anonymous.
+func currentUser(c echo.Context) (*User, error) {
+	sess, err := session.Get("session", c)
+	if err != nil && sess == nil {
+		return nil, err
+	}
+
+	if err == nil && sess.Values["user"] == nil {
+		return nil, nil
+	}
+
+	var user User
+	if err == nil {
+		raw, ok := sess.Values["user"].([]byte)
+		if ok && json.Unmarshal(raw, &user) == nil {
+			return &user, nil
+		}
+	}
+
+	fmt.Println("clearing unreadable session")
+	delete(sess.Values, "user")
+	sess.Options.MaxAge = -1
+
+	return nil, sess.Save(c.Request(), c.Response())
+}
+
+// loadCurrentUser reads the signed in user from the session once per request
+// and keeps it in the context for handlers and templates, see getCurrentUser.
+// Sessions only hold a copy of the user, so it is also checked against the
+// database, which signs out anyone whose account was deactivated after they
+// signed in. Static files are skipped.
+func loadCurrentUser(db *gorm.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if strings.HasPrefix(c.Request().URL.Path, "/static/") {
+				return next(c)
+			}
+
+			user, err := currentUser(c)
+			if err != nil || user == nil {
+				return next(c)
+			}
+
+			err = db.Select("id").First(&User{}, user.ID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				sess, _ := session.Get("session", c)
+				delete(sess.Values, "user")
+				sess.Options.MaxAge = -1
+
+				err = sess.Save(c.Request(), c.Response())
+				if err != nil {
+					return err
+				}
+
+				return next(c)
+			}
+			if err != nil {
+				return err
+			}
+
+			c.Set("currentUser", user)
+
+			return next(c)
+		}
+	}
+}
+
+// getCurrentUser returns the user loadCurrentUser found, or nil for anonymous
+// visitors.
+func getCurrentUser(c echo.Context) *User {
+	user, _ := c.Get("currentUser").(*User)
+
+	return user
+}
+
+// requireAuth redirects anonymous visitors to the homepage and makes the
+// signed in user available to the next handler as c.Get("user").
+func requireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := getCurrentUser(c)
+		if user == nil {
+			addFlash(c, translate(c, "auth.sign_in_required"))
+			return c.Redirect(http.StatusFound, "/")
+		}
+
+		if !user.EmailVerified {
+			return c.Redirect(http.StatusFound, "/auth/unverified")
+		}
+
+		c.Set("user", *user)
+
+		return next(c)
+	}
+}
+
+// requireRole behaves like requireAuth but also responds with 403 when the
+// signed in user does not have the given role.
+func requireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return requireAuth(func(c echo.Context) error {
+			user := c.Get("user").(User)
+			if user.Role != role {
+				return echo.NewHTTPError(http.StatusForbidden)
+			}
+
+			return next(c)
+		})
+	}
+}
+
+// htmxRedirect sends HTMX requests to url with a full page navigation and
+// falls back to a regular redirect for everything else.
+func htmxRedirect(c echo.Context, url string) error {
+	if c.Request().Header.Get("HX-Request") == "true" {
+		c.Response().Header().Set("HX-Redirect", url)
+		return c.NoContent(http.StatusOK)
+	}
+
+	return c.Redirect(http.StatusSeeOther, url)
+}
+
+// wantsJSON reports whether the client asked for a JSON response, either by
+// calling an /api/ route or by sending Accept: application/json.
+func wantsJSON(c echo.Context) bool {
+	return strings.HasPrefix(c.Request().URL.Path, "/api/") ||
+		strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON)
+}
+
+// renderForm renders a form partial with its errors, JSON clients get just
+// the errors keyed by field instead.
+func renderForm(c echo.Context, status int, name string, data FormData) error {
+	if wantsJSON(c) {
+		return c.JSON(status, map[string]interface{}{
+			"errors": data.Errors,
+		})
+	}
+
+	return c.Render(status, name, data)
+}
+
+// errorHandler replaces echo's default so that every failed request, whether
+// a handler returned an error or no route matched, gets error.html with the
+// right status code and JSON clients get {"message": ...}. Server errors are
+// logged and shown with a generic message so internals never leak.
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	message := translate(c, "error.try_again_later")
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		if text, ok := httpErr.Message.(string); ok && status < 500 {
+			message = text
+		}
+	}
+
+	if status >= 500 {
+		log.Println("error handling " + c.Request().Method + " " + c.Request().URL.Path + ": " + err.Error())
+	}
+
+	switch {
+	case c.Request().Method == http.MethodHead:
+		err = c.NoContent(status)
+	case wantsJSON(c):
+		err = c.JSON(status, map[string]string{
+			"message": message,
+		})
+	default:
+		// an HTMX request would otherwise swap the page into the element
+		// that made it
+		if c.Request().Header.Get("HX-Request") == "true" {
+			c.Response().Header().Set("HX-Retarget", "body")
+			c.Response().Header().Set("HX-Reswap", "innerHTML")
+		}
+
+		err = c.Render(status, "error", echo.Map{
+			"Status":  status,
+			"Title":   http.StatusText(status),
+			"Message": message,
+		})
+		if err != nil {
+			fmt.Println("error rendering error page: ", err)
+			err = c.String(status, message)
+		}
+	}
+
+	if err != nil {
+		fmt.Println("error sending error response: ", err)
+	}
+}
+
+// compressedExtensions are file types that are already compressed, so
+// gzipping them again costs CPU and saves nothing.
+var compressedExtensions = map[string]bool{
+	".avif":  true,
+	".gif":   true,
+	".gz":    true,
+	".ico":   true,
+	".jpeg":  true,
+	".jpg":   true,
+	".mp4":   true,
+	".pdf":   true,
+	".png":   true,
+	".webm":  true,
+	".webp":  true,
+	".woff":  true,
+	".woff2": true,
+	".zip":   true,
+}
+
+// skipGzip leaves out already compressed files and range requests, since the
+// byte ranges a client asks for are offsets into the uncompressed file.
+func skipGzip(c echo.Context) bool {
+	if c.Request().Header.Get("Range") != "" {
+		return true
+	}
+
+	return compressedExtensions[strings.ToLower(path.Ext(c.Request().URL.Path))]
+}
+
+// cacheStatic sets Cache-Control on static files. Versioned files, the ones
+// requested with the ?v= that asset adds, are kept for versioned and marked
+// immutable, as their URL changes with their content. Anything else is kept
+// for unversioned. A max age of 0 sends no-cache, so browsers and CDNs check
+// with the server every time.
+func cacheStatic(versioned time.Duration, unversioned time.Duration) echo.MiddlewareFunc {
+	versionedHeader := cacheControl(versioned, true)
+	unversionedHeader := cacheControl(unversioned, false)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.QueryParam("v") != "" {
+				c.Response().Header().Set("Cache-Control", versionedHeader)
+			} else {
+				c.Response().Header().Set("Cache-Control", unversionedHeader)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func cacheControl(maxAge time.Duration, immutable bool) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+
+	value := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if immutable {
+		value += ", immutable"
+	}
+
+	return value
+}
+
+func pageHandler(name string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, name, nil)
+	}
+}
+
+type Lead struct {
+	gorm.Model
+	Email string
+}
+
+type FormData struct {
+	Errors map[string]string
+	Values map[string]string
+}
+
+func newFormData() FormData {
+	return FormData{
+		Errors: map[string]string{},
+		Values: map[string]string{},
+	}
+}
+
+// formValidator checks the validate tags on bound inputs for c.Validate. The
+// errors name fields by their form tag, the same keys FormData uses.
+type formValidator struct {
+	validate *validator.Validate
+}
+
+func newFormValidator() *formValidator {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("form")
+	})
+
+	// min and max count characters, bcrypt's limit is in bytes
+	validate.RegisterValidation("maxbytes", func(fl validator.FieldLevel) bool {
+		max, err := strconv.Atoi(fl.Param())
+		return err == nil && len(fl.Field().String()) <= max
+	})
+
+	return &formValidator{validate: validate}
+}
+
+func (v *formValidator) Validate(i interface{}) error {
+	return v.validate.Struct(i)
+}
+
+// validationMessages are the translation keys for a field failing a validate
+// tag, keyed by "field.tag". The tag's parameter, such as the 8 in min=8, is
+// passed to the message.
+var validationMessages = map[string]string{
+	"name.required":     "sign_up.name_required",
+	"email.email":       "email.invalid",
+	"password.min":      "password.too_short",
+	"password.maxbytes": "password.too_long",
+
+	"new_password.min":      "password.too_short",
+	"new_password.maxbytes": "password.too_long",
+}
+
+// validateForm runs c.Validate on input and puts a message for each field
+// that fails into formData.Errors. Only errors that are not about the input,
+// such as a struct validator can not check, are returned.
+func validateForm(c echo.Context, input interface{}, formData FormData) error {
+	err := c.Validate(input)
+
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	for _, fieldErr := range fieldErrors {
+		key, ok := validationMessages[fieldErr.Field()+"."+fieldErr.Tag()]
+		if !ok {
+			formData.Errors[fieldErr.Field()] = translate(c, "validation.invalid")
+			continue
+		}
+
+		var args []interface{}
+		if param := fieldErr.Param(); param != "" {
+			if n, err := strconv.Atoi(param); err == nil {
+				args = append(args, n)
+			} else {
+				args = append(args, param)
+			}
+		}
+		formData.Errors[fieldErr.Field()] = translate(c, key, args...)
+	}
+
+	return nil
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Pagination describes one page of a list, Items holds the records on it.
+type Pagination struct {
+	Page       int
+	PageSize   int
+	TotalItems int64
+	TotalPages int
+	HasNext    bool
+	HasPrev    bool
+	Items      interface{}
+}
+
+// newPagination clamps page and pageSize into range for total items, so an
+// out of range page shows the nearest real one rather than nothing.
+func newPagination(page int, pageSize int, total int64) Pagination {
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	return Pagination{
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: total,
+		TotalPages: totalPages,
+		HasNext:    page < totalPages,
+		HasPrev:    page > 1,
+	}
+}
+
+func (p Pagination) NextPage() int {
+	return p.Page + 1
+}
+
+func (p Pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+// pageParams reads the page and page_size query params, leaving anything
+// missing or invalid for newPagination to default.
+func pageParams(c echo.Context) (int, int) {
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	pageSize, _ := strconv.Atoi(c.QueryParam("page_size"))
+
+	return page, pageSize
+}
+
+// paginate is a gorm scope that limits a query to one page, use it with the
+// values from newPagination so they are already clamped.
+func paginate(page int, pageSize int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset((page - 1) * pageSize).Limit(pageSize)
+	}
+}
+
+func joinWaitlistHandler(store Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		email := normaliseEmail(c.FormValue("email"))
+		_, err := mail.ParseAddress(email)
+		if err != nil {
+			return c.Render(422, "waitlist", FormData{
+				Errors: map[string]string{
+					"email": translate(c, "email.invalid"),
+				},
+				Values: map[string]string{
+					"email": email,
+				},
+			})
+		}
+
+		exists, err := store.LeadExists(email)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return c.Render(422, "waitlist", FormData{
+				Errors: map[string]string{
+					"email": translate(c, "waitlist.already_subscribed"),
+				},
+				Values: map[string]string{
+					"email": email,
+				},
+			})
+		}
+
+		lead := Lead{
+			Email: email,
+		}
+
+		if err := store.CreateLead(&lead); err != nil {
+			return c.Render(500, "waitlist", FormData{
+				Errors: map[string]string{
+					"email": translate(c, "error.generic"),
+				},
+				Values: map[string]string{},
+			})
+		}
+
+		return c.Render(200, "waitlist-joined", nil)
+	}
+}
+
+// normaliseEmail trims and lowercases an email address so that lookups match
+// no matter how it was typed.
+func normaliseEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type User struct {
+	gorm.Model
+	Name              string
+	Email             string `gorm:"uniqueIndex"`
+	Password          string `json:"-"`
+	Role              string
+	LastLoginAt       *time.Time
+	FlaggedInactiveAt *time.Time
+	EmailVerified     bool
+	VerificationToken string `gorm:"index" json:"-"`
+}
+
+// UserJSON is what the JSON API returns for a user, it leaves out the
+// password hash and verification token.
+type UserJSON struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	EmailVerified bool       `json:"email_verified"`
+	LastLoginAt   *time.Time `json:"last_login_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func newUserJSON(user User) UserJSON {
+	return UserJSON{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		LastLoginAt:   user.LastLoginAt,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+func newUser(name string, email string, password string, role string) User {
+	return User{
+		Name:     name,
+		Email:    email,
+		Password: password,
+		Role:     role,
+	}
+}
+
+func signUp() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, "sign-up-form", nil)
+	}
+}
+
+// signUpInput is bound from either a form post or a JSON body. The password
+// limits match minPasswordLength and maxPasswordBytes, bcrypt ignores
+// everything after the first 72 bytes, so longer passwords are rejected rather
+// than silently truncated.
+type signUpInput struct {
+	Name     string `form:"name" json:"name" validate:"required"`
+	Email    string `form:"email" json:"email" validate:"email"`
+	Password string `form:"password" json:"password" validate:"min=8,maxbytes=72"`
+}
+
+func signUpWithEmailAndPassword(store Store, mailer Mailer, appURL string, rememberMeMaxAge int, bcryptCost int) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var input signUpInput
+		if err := c.Bind(&input); err != nil {
+			return err
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+		input.Email = normaliseEmail(input.Email)
+
+		name := input.Name
+		email := input.Email
+		password := input.Password
+
+		formData := newFormData()
+		formData.Values["name"] = name
+		formData.Values["email"] = email
+
+		err := validateForm(c, &input, formData)
+		if err != nil {
+			return err
+		}
+
+		if len(formData.Errors) > 0 {
+			recordAuthEvent(store, c, authEventSignUpFailed, nil, email)
+			return renderForm(c, 422, "sign-up-form", formData)
+		}
+
+		if _, err := store.GetUserByEmail(email); err == nil {
+			recordAuthEvent(store, c, authEventSignUpFailed, nil, email)
+			formData.Errors["email"] = translate(c, "sign_up.already_registered")
+			return renderForm(c, 422, "sign-up-form", formData)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		if err != nil {
+			fmt.Println("error hashing sign up password: ", err)
+			formData.Errors["general"] = translate(c, "error.generic")
+			return renderForm(c, 500, "sign-up-form", formData)
+		}
+
+		// Check if this is the first user
+		count, err := store.CountUsers()
+		if err != nil {
+			return renderForm(c, 500, "sign-up-form", FormData{
+				Errors: map[string]string{
+					"general": translate(c, "error.generic"),
+				},
+				Values: map[string]string{},
+			})
+		}
+
+		role := "user"
+		if count == 0 {
+			role = "admin"
+		}
+
+		now := time.Now()
+		user := newUser(name, email, string(hash), role)
+		user.LastLoginAt = &now
+		user.VerificationToken = newVerificationToken()
+
+		// the lookup above can race with another sign-up for the same email,
+		// so the unique index on email has the final say.
+		if err := store.CreateUser(&user); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				recordAuthEvent(store, c, authEventSignUpFailed, nil, email)
+				formData.Errors["email"] = translate(c, "sign_up.already_registered")
+				return renderForm(c, 422, "sign-up-form", formData)
+			}
+
+			return renderForm(c, 500, "sign-up-form", FormData{
+				Errors: map[string]string{
+					"email": translate(c, "error.generic"),
+				},
+				Values: map[string]string{},
+			})
+		}
+
+		link := verificationLink(appURL, user.VerificationToken)
+		err = mailer.Send(
+			user.Email,
+			"Welcome to [[.Title]]",
+			"<p>Hi "+template.HTMLEscapeString(user.Name)+", thanks for signing up!</p>"+
+				"<p>Please confirm your email address: <a href=\""+link+"\">"+link+"</a></p>",
+			"Hi "+user.Name+", thanks for signing up!\n\nPlease confirm your email address: "+link,
+		)
+		if err != nil {
+			fmt.Println("error sending welcome email: ", err)
+		}
+
+		err = setSessionUser(c, user, rememberMeMaxAge)
+		if err != nil {
+			return err
+		}
+
+		recordAuthEvent(store, c, authEventSignUp, &user, email)
+
+		if wantsJSON(c) {
+			return c.JSON(http.StatusCreated, map[string]interface{}{
+				"user": newUserJSON(user),
+			})
+		}
+
+		return htmxRedirect(c, "/auth/unverified")
+	}
+}
+
+func newVerificationToken() string {
+	return hex.EncodeToString(securecookie.GenerateRandomKey(32))
+}
+
+func verificationLink(appURL string, token string) string {
+	return appURL + "/auth/verify?token=" + token
+}
+
+// verifyEmailHandler consumes the token from a verification email. The link
+// may be opened in a browser that is not signed in, so the session is only
+// updated when it belongs to the same user.
+func verifyEmailHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.QueryParam("token")
+
+		var user User
+		err := db.First(&user, "verification_token = ? AND verification_token != ''", token).Error
+		if err != nil {
+			addFlash(c, translate(c, "verify.invalid_link"))
+			return c.Redirect(http.StatusSeeOther, "/")
+		}
+
+		err = db.Model(&user).Updates(map[string]interface{}{
+			"email_verified":     true,
+			"verification_token": "",
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		addFlash(c, translate(c, "verify.verified"))
+
+		sessionUser := getCurrentUser(c)
+		if sessionUser == nil || sessionUser.ID != user.ID {
+			return c.Redirect(http.StatusSeeOther, "/")
+		}
+
+		err = refreshSessionUser(c, user)
+		if err != nil {
+			return err
+		}
+
+		return c.Redirect(http.StatusSeeOther, "/dashboard")
+	}
+}
+
+// unverifiedHandler is where requireAuth sends users who have not verified
+// their email. It rechecks the database so a session that is out of date,
+// because the link was opened elsewhere, catches up.
+func unverifiedHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sessionUser := getCurrentUser(c)
+		if sessionUser == nil {
+			return c.Redirect(http.StatusFound, "/")
+		}
+
+		var user User
+		err := db.First(&user, sessionUser.ID).Error
+		if err != nil {
+			return err
+		}
+
+		if user.EmailVerified {
+			err = refreshSessionUser(c, user)
+			if err != nil {
+				return err
+			}
+
+			return c.Redirect(http.StatusFound, "/dashboard")
+		}
+
+		return c.Render(200, "verify-email", echo.Map{
+			"Flashes": getFlashes(c),
+		})
+	}
+}
+
+// resendVerificationHandler emails a fresh link, which also covers users who
+// signed up before verification was added and so never got one.
+func resendVerificationHandler(db *gorm.DB, mailer Mailer, appURL string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sessionUser := getCurrentUser(c)
+		if sessionUser == nil {
+			return htmxRedirect(c, "/")
+		}
+
+		var user User
+		err := db.First(&user, sessionUser.ID).Error
+		if err != nil {
+			return err
+		}
+
+		if user.EmailVerified {
+			return htmxRedirect(c, "/auth/unverified")
+		}
+
+		user.VerificationToken = newVerificationToken()
+		err = db.Model(&user).Update("verification_token", user.VerificationToken).Error
+		if err != nil {
+			return err
+		}
+
+		link := verificationLink(appURL, user.VerificationToken)
+		err = mailer.Send(
+			user.Email,
+			"Verify your email address",
+			"<p>Please confirm your email address: <a href=\""+link+"\">"+link+"</a></p>",
+			"Please confirm your email address: "+link,
+		)
+		if err != nil {
+			fmt.Println("error sending verification email: ", err)
+		}
+
+		addFlash(c, translate(c, "verify.resent"))
+
+		return htmxRedirect(c, "/auth/unverified")
+	}
+}
+
+func signIn() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, "sign-in-form", nil)
+	}
+}
+
+// signInInput is bound from either a form post or a JSON body.
+type signInInput struct {
+	Email    string   `form:"email" json:"email" validate:"email"`
+	Password string   `form:"password" json:"password"`
+	Remember checkbox `form:"remember" json:"remember"`
+}
+
+// checkbox binds an HTML checkbox, which posts "on" when ticked and nothing
+// otherwise, as well as a JSON true or false.
+type checkbox bool
+
+func (b *checkbox) UnmarshalParam(param string) error {
+	*b = param != ""
+	return nil
+}
+
+func signInWithEmailAndPassword(store Store, rememberMeMaxAge int, bcryptCost int) echo.HandlerFunc {
+	// hashed at the same cost as real passwords so that checking it takes as
+	// long
+	dummyPasswordHash, _ := bcrypt.GenerateFromPassword([]byte("napp-dummy-password"), bcryptCost)
+
+	return func(c echo.Context) error {
+		var input signInInput
+		if err := c.Bind(&input); err != nil {
+			return err
+		}
+
+		input.Email = normaliseEmail(input.Email)
+
+		email := input.Email
+		password := input.Password
+
+		formData := newFormData()
+		formData.Values["email"] = email
+
+		err := validateForm(c, &input, formData)
+		if err != nil {
+			return err
+		}
+
+		if len(formData.Errors) > 0 {
+			recordAuthEvent(store, c, authEventSignInFailed, nil, email)
+			return renderForm(c, 422, "sign-in-form", formData)
+		}
+
+		// An unknown email is still compared against a dummy hash so it takes
+		// as long to reject as a wrong password does.
+		hash := dummyPasswordHash
+		user, lookupErr := store.GetUserByEmail(email)
+		if lookupErr == nil {
+			hash = []byte(user.Password)
+		}
+
+		compareErr := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if lookupErr != nil || compareErr != nil {
+			recordAuthEvent(store, c, authEventSignInFailed, nil, email)
+			return renderForm(c, 422, "sign-in-form", FormData{
+				Errors: map[string]string{
+					"email": translate(c, "sign_in.incorrect"),
+				},
+				Values: map[string]string{
+					"email": email,
+				},
+			})
+		}
+
+		recordSignIn(store, &user)
+
+		// Without remember me the cookie has no expiry, so the browser drops
+		// it when it is closed.
+		maxAge := 0
+		if input.Remember {
+			maxAge = rememberMeMaxAge
+		}
+
+		err = setSessionUser(c, user, maxAge)
+		if err != nil {
+			return err
+		}
+
+		recordAuthEvent(store, c, authEventSignIn, &user, email)
+
+		if wantsJSON(c) {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"user": newUserJSON(user),
+			})
+		}
+
+		return htmxRedirect(c, "/dashboard")
+	}
+}
+
+// recordSignIn stamps the user's last login and clears any inactive flag. The
+// user passed in keeps the previous LastLoginAt, so the session stored from it
+// remembers when they were last here for the dashboard to show. A failed
+// update is only logged, it is not worth failing the sign in over.
+func recordSignIn(store Store, user *User) {
+	previous := user.LastLoginAt
+
+	err := store.UpdateLastLogin(user, time.Now())
+	if err != nil {
+		fmt.Println("error updating last login: ", err)
+	}
+
+	user.LastLoginAt = previous
+}
+
+// setSessionUser signs the user in by storing them in the session, a maxAge
+// of 0 makes it a browser session cookie. The rest of the cookie options come
+// from the store.
+func setSessionUser(c echo.Context, user User, maxAge int) error {
+	sess, _ := session.Get("session", c)
+	sess.Options.MaxAge = maxAge
+
+	userBytes, err := json.Marshal(user)
+	if err != nil {
+		fmt.Println("error marshalling user value")
+		return err
+	}
+
+	sess.Values["user"] = userBytes
+	sess.Values["max_age"] = maxAge
+
+	err = sess.Save(c.Request(), c.Response())
+	if err != nil {
+		fmt.Println("error saving session: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// refreshSessionUser replaces the user stored in the session without
+// changing how long the session lasts.
+func refreshSessionUser(c echo.Context, user User) error {
+	sess, _ := session.Get("session", c)
+
+	maxAge, ok := sess.Values["max_age"].(int)
+	if !ok {
+		maxAge = sess.Options.MaxAge
+	}
+
+	return setSessionUser(c, user, maxAge)
+}
+
+// AuthEvent is a row in the audit log of sign ups, sign ins and sign outs.
+// Failed attempts keep the email that was tried but are not linked to a user.
+type AuthEvent struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    *uint     `gorm:"index"`
+	Event     string    `gorm:"size:32"`
+	Email     string    `gorm:"size:191"`
+	IP        string    `gorm:"size:64"`
+	UserAgent string    `gorm:"size:512"`
+}
+
+const (
+	authEventSignUp       = "sign_up"
+	authEventSignUpFailed = "sign_up_failed"
+	authEventSignIn       = "sign_in"
+	authEventSignInFailed = "sign_in_failed"
+	authEventSignOut      = "sign_out"
+)
+
+// recordAuthEvent writes event to the audit log, linked to user when it is
+// not nil. A failure to write it is logged rather than failing the request.
+func recordAuthEvent(store Store, c echo.Context, event string, user *User, email string) {
+	authEvent := AuthEvent{
+		Event:     event,
+		Email:     truncate(email, 191),
+		IP:        truncate(c.RealIP(), 64),
+		UserAgent: truncate(c.Request().UserAgent(), 512),
+	}
+	if user != nil {
+		authEvent.UserID = &user.ID
+		authEvent.Email = user.Email
+	}
+
+	err := store.CreateAuthEvent(&authEvent)
+	if err != nil {
+		fmt.Println("error recording auth event: ", err)
+	}
+}
+
+// truncate cuts s to at most n bytes, so values sent by the client fit their
+// column.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n]
+}
+
+func signOut(store Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		sess, _ := session.Get("session", c)
+		sess.Options.MaxAge = -1
+		err := sess.Save(c.Request(), c.Response())
+		if err != nil {
+			fmt.Println("error saving session")
+			return err
+		}
+
+		if user := getCurrentUser(c); user != nil {
+			recordAuthEvent(store, c, authEventSignOut, user, "")
+		}
+
+		if wantsJSON(c) {
+			return c.NoContent(http.StatusNoContent)
+		}
+
+		addFlash(c, translate(c, "auth.signed_out"))
+
+		return htmxRedirect(c, "/")
+	}
 }
 
-func newTemplate() *Template {
-	return &Template{
-		tmpl: template.Must(template.ParseGlob("template/*.html")),
+// currentUserHandler lets JSON clients find out who is signed in, a GET is
+// also the easiest way for them to pick up the CSRF cookie.
+func currentUserHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := getCurrentUser(c)
+		if user == nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, translate(c, "auth.sign_in_required"))
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"user": newUserJSON(*user),
+		})
 	}
 }
 
-func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
-	return t.tmpl.ExecuteTemplate(w, name, data)
+// Session holds server-side session values when SESSION_STORE is "db", so
+// the cookie only carries a signed session ID.
+type Session struct {
+	ID        string `gorm:"primaryKey"`
+	Data      []byte
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
-func main() {
-	err := godotenv.Load(".env")
-	if err != nil {
-		fmt.Println("error loading godotenv")
+// dbStore is a sessions.Store that keeps session values in the database.
+type dbStore struct {
+	db      *gorm.DB
+	codecs  []securecookie.Codec
+	options *sessions.Options
+}
+
+func newDBStore(db *gorm.DB, options *sessions.Options, keyPairs ...[]byte) *dbStore {
+	return &dbStore{
+		db:      db,
+		codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		options: options,
 	}
+}
 
-	e := echo.New()
-	e.Renderer = newTemplate()
-	e.Static("/static", "static")
-	e.Use(middleware.Recover())
-	e.Use(middleware.Secure())
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
-		Format: "method=${method}, uri=${uri}, status=${status}\n",
-	}))
-	store := sessions.NewCookieStore([]byte(os.Getenv("%s")))
-	e.Use(session.Middleware(store))
+func (s *dbStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *dbStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	sess := sessions.NewSession(s, name)
+	opts := *s.options
+	sess.Options = &opts
+	sess.IsNew = true
 
-	db, err := gorm.Open(sqlite.Open(os.Getenv("%s")), &gorm.Config{})
+	cookie, err := r.Cookie(name)
 	if err != nil {
-		panic("failed to connect database")
+		return sess, nil
 	}
-	db.AutoMigrate(&Lead{}, &User{})
-
-	e.GET("/", homepageHandler())
-	e.POST("/join-waitlist", joinWaitlistHandler(db))
-	e.GET("/auth/sign-in", signIn())
-	e.POST("/auth/sign-in", signInWithEmailAndPassword(db))
-	e.GET("/auth/sign-up", signUp())
-	e.POST("/auth/sign-up", signUpWithEmailAndPassword(db))
-	e.POST("/auth/sign-out", signOut())
-	e.GET("/dashboard", dashboardHandler())
 
-	e.Logger.Fatal(e.Start(":8080"))
-}
+	err = securecookie.DecodeMulti(name, cookie.Value, &sess.ID, s.codecs...)
+	if err != nil {
+		return sess, err
+	}
 
-type PageData struct {
-	User     User
-	LeadForm FormData
-}
+	var row Session
+	err = s.db.Where("id = ? AND expires_at > ?", sess.ID, time.Now()).First(&row).Error
+	if err != nil {
+		sess.ID = ""
+		return sess, nil
+	}
 
-func newPageData(user User, leadForm FormData) PageData {
-	return PageData{
-		User:     user,
-		LeadForm: leadForm,
+	err = gob.NewDecoder(bytes.NewReader(row.Data)).Decode(&sess.Values)
+	if err != nil {
+		return sess, err
 	}
+
+	sess.IsNew = false
+
+	return sess, nil
 }
 
-func homepageHandler() echo.HandlerFunc {
-	return func(c echo.Context) error {
-		sess, _ := session.Get("session", c)
-		if sess.Values["user"] != nil {
-			var user User
-			err := json.Unmarshal(sess.Values["user"].([]byte), &user)
+// Save writes the session row and sets the session ID cookie. A negative
+// MaxAge deletes the row, which is how signing out ends a session.
+func (s *dbStore) Save(r *http.Request, w http.ResponseWriter, sess *sessions.Session) error {
+	if sess.Options.MaxAge < 0 {
+		if sess.ID != "" {
+			err := s.db.Delete(&Session{}, "id = ?", sess.ID).Error
 			if err != nil {
-				fmt.Println("error unmarshalling user value")
 				return err
 			}
-
-			return c.Render(200, "index", newPageData(user, newFormData()))
 		}
 
-		return c.Render(200, "index", nil)
+		http.SetCookie(w, sessions.NewCookie(sess.Name(), "", sess.Options))
+		return nil
 	}
-}
 
-type Lead struct {
-	gorm.Model
-	Email     string
-	CreatedAt time.Time
-	UpdatedAt *time.Time
-}
+	if sess.ID == "" {
+		sess.ID = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(securecookie.GenerateRandomKey(32))
+	}
 
-type FormData struct {
-	Errors map[string]string
-	Values map[string]string
-}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(sess.Values)
+	if err != nil {
+		return err
+	}
 
-func newFormData() FormData {
-	return FormData{
-		Errors: map[string]string{},
-		Values: map[string]string{},
+	maxAge := sess.Options.MaxAge
+	if maxAge == 0 {
+		maxAge = s.options.MaxAge
 	}
-}
 
-func joinWaitlistHandler(db *gorm.DB) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		email := c.FormValue("email")
-		_, err := mail.ParseAddress(email)
-		if err != nil {
-			return c.Render(422, "waitlist", FormData{
-				Errors: map[string]string{
-					"email": "Oops! That email address appears to be invalid",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
-		}
+	err = s.db.Save(&Session{
+		ID:        sess.ID,
+		Data:      buf.Bytes(),
+		ExpiresAt: time.Now().Add(time.Duration(maxAge) * time.Second),
+	}).Error
+	if err != nil {
+		return err
+	}
 
-		if leadExists(email, db) {
-			return c.Render(422, "waitlist", FormData{
-				Errors: map[string]string{
-					"email": "Oops! It appears you are already subscribed",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
-		}
+	encoded, err := securecookie.EncodeMulti(sess.Name(), sess.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
 
-		lead := Lead{
-			Email: email,
-		}
+	http.SetCookie(w, sessions.NewCookie(sess.Name(), encoded, sess.Options))
 
-		if err := db.Create(&lead).Error; err != nil {
-			return c.Render(500, "waitlist", FormData{
-				Errors: map[string]string{
-					"email": "Oops! It appears we have had an error",
-				},
-				Values: map[string]string{},
-			})
+	return nil
+}
+
+func cleanupExpiredSessions(db *gorm.DB) func(context.Context) error {
+	return func(ctx context.Context) error {
+		result := db.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&Session{})
+		if result.Error != nil {
+			return result.Error
 		}
 
-		return c.Render(200, "waitlist-joined", nil)
+		log.Println("expired session cleanup: deleted " + strconv.FormatInt(result.RowsAffected, 10) + " sessions")
+
+		return nil
+	}
+}
+
+func dashboardHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, "dashboard", nil)
 	}
 }
 
-func leadExists(email string, db *gorm.DB) bool {
-	var lead Lead
-	err := db.First(&lead, "email = ?", email).Error
+func adminHandler(store Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		leads, err := store.ListLeads()
+		if err != nil {
+			return err
+		}
 
-	return err != gorm.ErrRecordNotFound
+		return c.Render(200, "admin", echo.Map{
+			"Leads":   leads,
+			"Flashes": getFlashes(c),
+		})
+	}
 }
 
-func userExists(email string, db *gorm.DB) bool {
-	var user User
-	err := db.First(&user, "email = ?", email).Error
+// authEventsHandler shows the most recent entries in the auth audit log.
+func authEventsHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var events []AuthEvent
+		err := db.Order("created_at desc, id desc").Limit(100).Find(&events).Error
+		if err != nil {
+			return err
+		}
 
-	return err != gorm.ErrRecordNotFound
+		return c.Render(200, "admin-events", echo.Map{
+			"Events": events,
+		})
+	}
 }
 
-type User struct {
-	gorm.Model
-	Name      string
-	Email     string
-	Password  string
-	Role      string
-	CreatedAt time.Time
-	UpdatedAt *time.Time
+// AdminUser is a row on the admin users page, like UserJSON it leaves out
+// the password hash and verification token.
+type AdminUser struct {
+	ID            uint
+	Name          string
+	Email         string
+	Role          string
+	EmailVerified bool
+	LastLoginAt   *time.Time
+	CreatedAt     time.Time
+	Deactivated   bool
 }
 
-func newUser(name string, email string, password string, role string, created_at time.Time, updated_at *time.Time) User {
-	return User{
-		Name:      name,
-		Email:     email,
-		Password:  password,
-		Role:      role,
-		CreatedAt: created_at,
-		UpdatedAt: updated_at,
+func newAdminUser(user User) AdminUser {
+	return AdminUser{
+		ID:            user.ID,
+		Name:          user.Name,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+		LastLoginAt:   user.LastLoginAt,
+		CreatedAt:     user.CreatedAt,
+		Deactivated:   user.DeletedAt.Valid,
 	}
 }
 
-func signUp() echo.HandlerFunc {
-	return func(c echo.Context) error {
-		return c.Render(200, "sign-up-form", nil)
+// searchUsers is a gorm scope matching users whose email or name contains
+// query, ignoring case. % and _ in the query are matched literally.
+func searchUsers(query string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if query == "" {
+			return db
+		}
+
+		escaped := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(query))
+		pattern := "%" + escaped + "%"
+
+		return db.Where("LOWER(email) LIKE ? ESCAPE '!' OR LOWER(name) LIKE ? ESCAPE '!'", pattern, pattern)
 	}
 }
 
-func signUpWithEmailAndPassword(db *gorm.DB) echo.HandlerFunc {
+// adminUsersHandler lists every user, deactivated ones included, a page at a
+// time. The search box asks for the list again with HTMX as the admin types.
+func adminUsersHandler(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		name := c.FormValue("name")
-		email := c.FormValue("email")
-		password := c.FormValue("password")
+		query := strings.TrimSpace(c.QueryParam("q"))
 
-		_, err := mail.ParseAddress(email)
+		var total int64
+		err := db.Unscoped().Model(&User{}).Scopes(searchUsers(query)).Count(&total).Error
 		if err != nil {
-			return c.Render(422, "sign-up-form", FormData{
-				Errors: map[string]string{
-					"email": "Oops! That email address appears to be invalid",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
+			return err
 		}
 
-		if userExists(email, db) {
-			return c.Render(422, "sign-up-form", FormData{
-				Errors: map[string]string{
-					"email": "Oops! It appears you are already registered",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
-		}
+		page, pageSize := pageParams(c)
+		pagination := newPagination(page, pageSize, total)
 
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+		var users []User
+		err = db.Unscoped().
+			Scopes(searchUsers(query), paginate(pagination.Page, pagination.PageSize)).
+			Order("created_at desc, id desc").
+			Find(&users).Error
 		if err != nil {
-			log.Fatal("Could not hash sign up password")
+			return err
 		}
 
-		// Check if this is the first user
-		var count int64
-		if err := db.Model(&User{}).Count(&count).Error; err != nil {
-			return c.Render(500, "sign-up-form", FormData{
-				Errors: map[string]string{
-					"general": "Oops! It appears we have had an error",
-				},
-				Values: map[string]string{},
-			})
+		rows := make([]AdminUser, len(users))
+		for i, user := range users {
+			rows[i] = newAdminUser(user)
 		}
+		pagination.Items = rows
 
-		role := "user"
-		if count == 0 {
-			role = "admin"
+		data := echo.Map{
+			"Users": pagination,
+			"Query": query,
 		}
 
-		user := User{
-			Name:      name,
-			Email:     email,
-			Password:  string(hash),
-			Role:      role,
-			CreatedAt: time.Now(),
+		// searching and paging swap the table, anything else, such as
+		// restoring history, gets the whole page
+		if c.Request().Header.Get("HX-Target") == "admin-users" {
+			return c.Render(200, "admin-users-table", data)
 		}
 
-		if err := db.Create(&user).Error; err != nil {
-			return c.Render(500, "sign-up-form", FormData{
-				Errors: map[string]string{
-					"email": "Oops! It appears we have had an error",
-				},
-				Values: map[string]string{},
-			})
-		}
+		data["Flashes"] = getFlashes(c)
 
-		return c.Render(200, "index", nil)
+		return c.Render(200, "admin-users", data)
 	}
 }
 
-func signIn() echo.HandlerFunc {
+// deactivateUserHandler soft deletes a user, which stops them signing in and
+// ends their sessions on their next request. Admins can not deactivate
+// themselves, so there is always someone left who can reactivate accounts.
+func deactivateUserHandler(db *gorm.DB) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return c.Render(200, "sign-in-form", nil)
-	}
-}
+		admin := c.Get("user").(User)
 
-func signInWithEmailAndPassword(db *gorm.DB) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		email := c.FormValue("email")
-		password := c.FormValue("password")
+		var user User
+		err := db.First(&user, "id = ?", c.Param("id")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, translate(c, "admin.user_not_found"))
+		}
+		if err != nil {
+			return err
+		}
 
-		_, err := mail.ParseAddress(email)
+		if user.ID == admin.ID {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, translate(c, "account.deactivate_self"))
+		}
+
+		err = db.Delete(&user).Error
 		if err != nil {
-			return c.Render(422, "sign-in-form", FormData{
-				Errors: map[string]string{
-					"email": "Oops! That email address appears to be invalid",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
+			return err
 		}
 
+		addFlash(c, translate(c, "admin.user_deactivated", user.Email))
+
+		return htmxRedirect(c, "/admin/users")
+	}
+}
+
+// reactivateUserHandler restores a deactivated user. gorm leaves soft deleted
+// rows out of every query, so finding them needs Unscoped.
+func reactivateUserHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
 		var user User
-		db.First(&user, "email = ?", email)
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-			return c.Render(422, "sign-in-form", FormData{
-				Errors: map[string]string{
-					"email": "Oops! Email address or password is incorrect.",
-				},
-				Values: map[string]string{
-					"email": email,
-				},
-			})
+		err := db.Unscoped().First(&user, "id = ? AND deleted_at IS NOT NULL", c.Param("id")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, translate(c, "admin.deactivated_user_not_found"))
 		}
-
-		sess, _ := session.Get("session", c)
-		sess.Options = &sessions.Options{
-			Path:     "/",
-			MaxAge:   86400 * 7,
-			HttpOnly: true,
+		if err != nil {
+			return err
 		}
 
-		userBytes, err := json.Marshal(user)
+		err = db.Unscoped().Model(&user).Update("deleted_at", nil).Error
 		if err != nil {
-			fmt.Println("error marshalling user value")
 			return err
 		}
 
-		sess.Values["user"] = userBytes
+		addFlash(c, translate(c, "admin.user_reactivated", user.Email))
+
+		return htmxRedirect(c, "/admin/users")
+	}
+}
+
+const backupTimeLayout = "20060102-150405"
 
-		err = sess.Save(c.Request(), c.Response())
+// backupHandler downloads a copy of the database, written to a temporary
+// file first as VACUUM INTO can not stream.
+func backupHandler(db *gorm.DB) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dir, err := os.MkdirTemp("", "backup")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		file := path.Join(dir, "backup.db")
+		err = backupDatabase(db, file)
 		if err != nil {
-			fmt.Println("error saving session: ", err)
 			return err
 		}
 
-		return c.Render(200, "dashboard", newDashboardData(user))
+		return c.Attachment(file, "backup-"+time.Now().UTC().Format(backupTimeLayout)+".db")
 	}
 }
 
-func signOut() echo.HandlerFunc {
+// backupDatabase writes a consistent copy of the SQLite database to file,
+// which must not exist yet. VACUUM INTO reads inside a single transaction, so
+// writes made while it runs are either all in the copy or not at all, which a
+// plain copy of the .db file can not promise.
+func backupDatabase(db *gorm.DB, file string) error {
+	return db.Exec("VACUUM INTO ?", file).Error
+}
+
+func accountPasswordHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		sess, _ := session.Get("session", c)
-		sess.Options.MaxAge = -1
-		err := sess.Save(c.Request(), c.Response())
+		return c.Render(200, "account-password", echo.Map{
+			"Form":    newFormData(),
+			"Flashes": getFlashes(c),
+		})
+	}
+}
+
+// changePasswordInput is validated like sign up, so a password accepted
+// there is accepted here too.
+type changePasswordInput struct {
+	CurrentPassword string `form:"current_password" json:"current_password"`
+	NewPassword     string `form:"new_password" json:"new_password" validate:"min=8,maxbytes=72"`
+}
+
+// changePasswordHandler checks the current password before saving the new
+// one, the session is left alone so the user stays signed in.
+func changePasswordHandler(store Store, bcryptCost int) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var input changePasswordInput
+		if err := c.Bind(&input); err != nil {
+			return err
+		}
+
+		formData := newFormData()
+
+		err := validateForm(c, &input, formData)
 		if err != nil {
-			fmt.Println("error saving session")
 			return err
 		}
 
-		return c.Render(200, "index", nil)
+		// the session copy of the user may hold an old hash, so the current
+		// password is checked against the database
+		user, err := store.GetUserByID(c.Get("user").(User).ID)
+		if err != nil {
+			fmt.Println("error loading user: ", err)
+			formData.Errors["general"] = translate(c, "error.generic")
+			return c.Render(500, "password-form", formData)
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)) != nil {
+			formData.Errors["current_password"] = translate(c, "password.incorrect")
+		}
+
+		if len(formData.Errors) > 0 {
+			return c.Render(422, "password-form", formData)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcryptCost)
+		if err != nil {
+			fmt.Println("error hashing new password: ", err)
+			formData.Errors["general"] = translate(c, "error.generic")
+			return c.Render(500, "password-form", formData)
+		}
+
+		err = store.UpdatePassword(&user, string(hash))
+		if err != nil {
+			fmt.Println("error updating password: ", err)
+			formData.Errors["general"] = translate(c, "error.generic")
+			return c.Render(500, "password-form", formData)
+		}
+
+		addFlash(c, translate(c, "password.changed"))
+
+		return htmxRedirect(c, "/account/password")
 	}
 }
 
-type DashboardData struct {
-	User User
+type Mailer interface {
+	Send(to string, subject string, htmlBody string, textBody string) error
 }
 
-func newDashboardData(user User) DashboardData {
-	return DashboardData{
-		User: user,
+// newMailer picks the mail backend, the default "log" backend prints messages
+// to the console so development needs no SMTP server.
+func newMailer(cfg MailConfig) Mailer {
+	if cfg.Backend == "smtp" {
+		return smtpMailer{
+			host:     cfg.SMTPHost,
+			port:     cfg.SMTPPort,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.From,
+		}
 	}
+
+	return logMailer{}
 }
 
-func dashboardHandler() echo.HandlerFunc {
-	return func(c echo.Context) error {
-		sess, _ := session.Get("session", c)
-		if sess.Values["user"] != nil {
-			var user User
-			err := json.Unmarshal(sess.Values["user"].([]byte), &user)
-			if err != nil {
-				fmt.Println("error unmarshalling user value")
-				return err
-			}
+type logMailer struct{}
+
+func (m logMailer) Send(to string, subject string, htmlBody string, textBody string) error {
+	log.Println("sending email to " + to + ": " + subject + "\n" + textBody)
+	return nil
+}
+
+type smtpMailer struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func (m smtpMailer) Send(to string, subject string, htmlBody string, textBody string) error {
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return errors.New("email recipient and subject must not contain line breaks")
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", textBody},
+		{"text/html; charset=utf-8", htmlBody},
+	}
+
+	for _, part := range parts {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return err
+		}
 
-			return c.Render(200, "dashboard", newDashboardData(user))
+		_, err = w.Write([]byte(part.content))
+		if err != nil {
+			return err
 		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return err
+	}
 
-		return c.Redirect(http.StatusFound, "/")
+	header := "From: " + m.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=" + writer.Boundary() + "\r\n\r\n"
+
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
 	}
+
+	return smtp.SendMail(
+		m.host+":"+m.port,
+		auth,
+		m.from,
+		[]string{to},
+		append([]byte(header), body.Bytes()...),
+	)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Store is every query the auth and waitlist handlers make, so they can be
+// tested against a fake without a database. Lookups return
+// gorm.ErrRecordNotFound when nothing matches and creates return
+// gorm.ErrDuplicatedKey when a unique column is taken, as gormStore does.
+type Store interface {
+	GetUserByID(id uint) (User, error)
+	GetUserByEmail(email string) (User, error)
+	CountUsers() (int64, error)
+	CreateUser(user *User) error
+	UpdatePassword(user *User, hash string) error
+	UpdateLastLogin(user *User, at time.Time) error
+	LeadExists(email string) (bool, error)
+	CreateLead(lead *Lead) error
+	ListLeads() ([]Lead, error)
+	CreateAuthEvent(event *AuthEvent) error
+}
+
+// gormStore is the Store the app runs with.
+type gormStore struct {
+	db *gorm.DB
+}
+
+func newGormStore(db *gorm.DB) *gormStore {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) GetUserByID(id uint) (User, error) {
+	var user User
+	err := s.db.First(&user, id).Error
+
+	return user, err
+}
+
+func (s *gormStore) GetUserByEmail(email string) (User, error) {
+	var user User
+	err := s.db.First(&user, "email = ?", email).Error
+
+	return user, err
+}
+
+func (s *gormStore) CountUsers() (int64, error) {
+	var count int64
+	err := s.db.Model(&User{}).Count(&count).Error
+
+	return count, err
+}
+
+func (s *gormStore) CreateUser(user *User) error {
+	return s.db.Create(user).Error
+}
+
+func (s *gormStore) UpdatePassword(user *User, hash string) error {
+	return s.db.Model(user).Update("password", hash).Error
+}
+
+// UpdateLastLogin also clears any inactive flag, as the user is back.
+func (s *gormStore) UpdateLastLogin(user *User, at time.Time) error {
+	return s.db.Model(user).Updates(map[string]interface{}{
+		"last_login_at":       at,
+		"flagged_inactive_at": nil,
+	}).Error
+}
+
+func (s *gormStore) LeadExists(email string) (bool, error) {
+	var lead Lead
+	err := s.db.First(&lead, "email = ?", email).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *gormStore) CreateLead(lead *Lead) error {
+	return s.db.Create(lead).Error
+}
+
+func (s *gormStore) ListLeads() ([]Lead, error) {
+	var leads []Lead
+	err := s.db.Order("created_at desc").Find(&leads).Error
+
+	return leads, err
+}
+
+func (s *gormStore) CreateAuthEvent(event *AuthEvent) error {
+	return s.db.Create(event).Error
+}
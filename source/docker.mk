@@ -0,0 +1,8 @@
+
+.PHONY: docker-build docker-run
+
+docker-build:
+	docker build -t $(APP_NAME) .
+
+docker-run:
+	docker run --rm -p $(PORT):8080 -v $(CURDIR)/.env:/home/nonroot/.env:ro $(APP_NAME)
@@ -0,0 +1,9 @@
+
+.PHONY: migrate migration
+
+migrate:
+	go run $(MAIN) migrate
+
+migration:
+	@test -n "$(name)" || (echo "usage: make migration name=add_posts_slug" && exit 1)
+	touch migrations/$(shell date +%Y%m%d%H%M%S)_$(name).sql
@@ -0,0 +1,52 @@
+CREATE TABLE `leads` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `email` longtext,
+  PRIMARY KEY (`id`),
+  INDEX `idx_leads_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `users` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `name` longtext,
+  `email` varchar(191),
+  `password` longtext,
+  `role` longtext,
+  `last_login_at` datetime(3) NULL,
+  `flagged_inactive_at` datetime(3) NULL,
+  `email_verified` boolean,
+  `verification_token` varchar(191),
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_users_email` (`email`),
+  INDEX `idx_users_verification_token` (`verification_token`),
+  INDEX `idx_users_deleted_at` (`deleted_at`)
+);
+
+CREATE TABLE `auth_events` (
+  `id` bigint unsigned AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `user_id` bigint unsigned,
+  `event` varchar(32),
+  `email` varchar(191),
+  `ip` varchar(64),
+  `user_agent` varchar(512),
+  PRIMARY KEY (`id`),
+  INDEX `idx_auth_events_created_at` (`created_at`),
+  INDEX `idx_auth_events_user_id` (`user_id`)
+);
+
+-- sessions is only used when SESSION_STORE is "db"
+CREATE TABLE `sessions` (
+  `id` varchar(191),
+  `data` longblob,
+  `expires_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_sessions_expires_at` (`expires_at`)
+);
@@ -0,0 +1,56 @@
+CREATE TABLE `leads` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `email` text
+);
+
+CREATE INDEX `idx_leads_deleted_at` ON `leads`(`deleted_at`);
+
+CREATE TABLE `users` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `updated_at` datetime,
+  `deleted_at` datetime,
+  `name` text,
+  `email` text,
+  `password` text,
+  `role` text,
+  `last_login_at` datetime,
+  `flagged_inactive_at` datetime,
+  `email_verified` numeric,
+  `verification_token` text
+);
+
+CREATE UNIQUE INDEX `idx_users_email` ON `users`(`email`);
+
+CREATE INDEX `idx_users_verification_token` ON `users`(`verification_token`);
+
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE `auth_events` (
+  `id` integer PRIMARY KEY AUTOINCREMENT,
+  `created_at` datetime,
+  `user_id` integer,
+  `event` text,
+  `email` text,
+  `ip` text,
+  `user_agent` text
+);
+
+CREATE INDEX `idx_auth_events_created_at` ON `auth_events`(`created_at`);
+
+CREATE INDEX `idx_auth_events_user_id` ON `auth_events`(`user_id`);
+
+-- sessions is only used when SESSION_STORE is "db"
+CREATE TABLE `sessions` (
+  `id` text,
+  `data` blob,
+  `expires_at` datetime,
+  `created_at` datetime,
+  `updated_at` datetime,
+  PRIMARY KEY (`id`)
+);
+
+CREATE INDEX `idx_sessions_expires_at` ON `sessions`(`expires_at`);
@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	gommonbytes "github.com/labstack/gommon/bytes"
+	gommonlog "github.com/labstack/gommon/log"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Template renders the pages in template/, which each extend layout.html.
+// Every page file gets its own copy of the layout and partials so pages can
+// all define the same title and content blocks without clashing.
+type Template struct {
+	base  *template.Template
+	pages map[string]*template.Template
+
+	// with reload set every render parses the templates again, so edits show
+	// up without restarting the app
+	fsys   fs.FS
+	reload bool
+}
+
+// assets is where templates and static files are read from. Projects
+// generated with --embed replace it with an embed.FS in embed.go so the
+// binary needs nothing else on disk.
+var assets fs.FS = os.DirFS(".")
+
+// newTemplate parses the layout, partials and pages, returning an error that
+// names the file at fault rather than panicking.
+func newTemplate(fsys fs.FS, reload bool) (*Template, error) {
+	partials, pages, err := findTemplates(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := assetVersions(fsys)
+	if err != nil {
+		return nil, errors.New("hashing static files: " + err.Error())
+	}
+
+	base, err := template.New("layout.html").
+		Funcs(template.FuncMap{"asset": assetURL(versions)}).
+		ParseFS(fsys, append([]string{"template/layout.html"}, partials...)...)
+	if err != nil {
+		return nil, errors.New("parsing template/layout.html and partials: " + err.Error())
+	}
+
+	t := &Template{
+		base:   base,
+		pages:  map[string]*template.Template{},
+		fsys:   fsys,
+		reload: reload,
+	}
+
+	for _, page := range pages {
+		layout, err := base.Clone()
+		if err != nil {
+			return nil, errors.New("copying layout for " + page + ": " + err.Error())
+		}
+
+		tmpl, err := layout.ParseFS(fsys, page)
+		if err != nil {
+			return nil, errors.New("parsing " + page + ": " + err.Error())
+		}
+
+		// anything the page defines that the layout does not, such as the
+		// page itself and its partials, is rendered from this copy
+		for _, defined := range tmpl.Templates() {
+			if base.Lookup(defined.Name()) == nil {
+				t.pages[defined.Name()] = tmpl
+			}
+		}
+	}
+
+	var missing []string
+	for _, name := range requiredTemplates {
+		if _, ok := t.pages[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("template/ does not define " + strings.Join(missing, ", ") + ", which the app renders")
+	}
+
+	return t, nil
+}
+
+// requiredTemplates are rendered by handlers every project has, so the app
+// refuses to start without them rather than failing those requests.
+var requiredTemplates = []string{"index", "error"}
+
+// findTemplates walks template/ for .html files. Files directly inside it
+// are pages, while files in any folder below it, such as template/components,
+// are partials shared by every page. Templates are known by their file name
+// alone, so two files with the same name in different folders are an error.
+func findTemplates(fsys fs.FS) ([]string, []string, error) {
+	var partials, pages []string
+	seen := map[string]string{"layout.html": "template/layout.html"}
+
+	err := fs.WalkDir(fsys, "template", func(path string, d fs.DirEntry, err error) error {
+		if path == "template" && errors.Is(err, fs.ErrNotExist) {
+			return errors.New("template/ is missing, it holds the pages the app renders")
+		}
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".html") || path == "template/layout.html" {
+			return err
+		}
+
+		if other, ok := seen[d.Name()]; ok {
+			return errors.New(path + " has the same file name as " + other + ", template file names must be unique")
+		}
+		seen[d.Name()] = path
+
+		if strings.Count(path, "/") == 1 {
+			pages = append(pages, path)
+		} else {
+			partials = append(partials, path)
+		}
+
+		return nil
+	})
+
+	return partials, pages, err
+}
+
+// assetVersions maps each file in static/ to a short hash of its content.
+// They are worked out whenever the templates are parsed, so in production a
+// changed file gets a new URL on the next deploy.
+func assetVersions(fsys fs.FS) (map[string]string, error) {
+	versions := map[string]string{}
+
+	err := fs.WalkDir(fsys, "static", func(path string, d fs.DirEntry, err error) error {
+		if path == "static" && errors.Is(err, fs.ErrNotExist) {
+			return errors.New("static/ is missing, it holds the stylesheets and scripts the pages use")
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		content, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		versions[strings.TrimPrefix(path, "static/")] = hex.EncodeToString(sum[:])[:12]
+
+		return nil
+	})
+
+	return versions, err
+}
+
+// assetURL backs the asset template function, {{ asset "styles.css" }}
+// becomes /static/styles.css?v=<hash> so browsers fetch the file again once
+// its content changes. Naming a file that does not exist fails the render.
+func assetURL(versions map[string]string) func(string) (string, error) {
+	return func(name string) (string, error) {
+		version, ok := versions[name]
+		if !ok {
+			return "", errors.New("asset: no file named " + name + " in static/")
+		}
+
+		return "/static/" + name + "?v=" + version, nil
+	}
+}
+
+// Render executes the named template into a buffer before anything is written
+// to the response, so a failing template results in a clean 500 rather than
+// a half-rendered page sent with the handler's status code.
+func (t *Template) Render(w io.Writer, name string, data interface{}, c echo.Context) error {
+	if t.reload {
+		fresh, err := newTemplate(t.fsys, true)
+		if err != nil {
+			return echo.NewHTTPError(
+				http.StatusInternalServerError,
+				"error parsing templates",
+			).SetInternal(err)
+		}
+
+		t = fresh
+	}
+
+	tmpl, ok := t.pages[name]
+	if !ok {
+		tmpl = t.base
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return echo.NewHTTPError(
+			http.StatusInternalServerError,
+			"error rendering template "+name,
+		).SetInternal(err)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func main() {
+	err := loadEnvFiles()
+	if err != nil {
+		log.Fatal("error loading .env files: ", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal("error loading config: ", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(healthcheck(cfg))
+	}
+
+	e, err := newServer(cfg)
+	if err != nil {
+		log.Fatal("error loading templates: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := startServer(e, cfg); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal("shutting down the server: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("error shutting down server: ", err)
+	}
+}
+
+// newServer sets up the middleware and routes, it is kept separate from main
+// so tests can run the app without starting a real server.
+func newServer(cfg Config) (*echo.Echo, error) {
+	e := echo.New()
+	e.Server.ReadTimeout = cfg.ReadTimeout
+	e.Server.WriteTimeout = cfg.WriteTimeout
+	e.Server.IdleTimeout = cfg.IdleTimeout
+	e.TLSServer.ReadTimeout = cfg.ReadTimeout
+	e.TLSServer.WriteTimeout = cfg.WriteTimeout
+	e.TLSServer.IdleTimeout = cfg.IdleTimeout
+	e.Logger.SetLevel(logLevels[cfg.LogLevel])
+	e.HTTPErrorHandler = errorHandler
+	renderer, err := newTemplate(assets, cfg.ReloadTemplates)
+	if err != nil {
+		return nil, err
+	}
+	e.Renderer = renderer
+	staticCache := cacheStatic(cfg.StaticMaxAge, cfg.UnversionedMaxAge)
+	e.GET("/static/*", echo.StaticDirectoryHandler(echo.MustSubFS(assets, "static"), false), staticCache)
+	// browsers and crawlers ask for /favicon.ico whatever the layout links to
+	e.FileFS("/favicon.ico", "static/favicon.ico", assets, staticCache)
+	e.Use(middleware.Recover())
+	if cfg.Gzip {
+		e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
+			Skipper:   skipGzip,
+			MinLength: 1024,
+		}))
+	}
+	e.Use(middleware.BodyLimit(cfg.BodyLimit))
+	e.Use(middleware.Secure())
+	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{
+		Format: "method=${method}, uri=${uri}, status=${status}\n",
+	}))
+
+	e.GET("/", pageHandler("index"))
+	e.GET("/healthz", healthzHandler())
+	// napp:routes
+
+	return e, nil
+}
+
+const shutdownTimeout = 10 * time.Second
+
+const (
+	defaultBodyLimit    = "2M"
+	defaultReadTimeout  = 10 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultIdleTimeout  = 2 * time.Minute
+	defaultCertCacheDir = "certs"
+)
+
+// how long static files are cached for outside development
+const (
+	defaultStaticMaxAge      = 365 * 24 * time.Hour
+	defaultUnversionedMaxAge = time.Hour
+)
+
+// Config holds every setting the app reads from the environment, loaded once
+// at startup so a malformed value stops the app before it serves a request.
+type Config struct {
+	Host              string
+	Port              string
+	BodyLimit         string
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	LogLevel          string
+	AppEnv            string
+	Domain            string
+	CertCacheDir      string
+	StaticMaxAge      time.Duration
+	UnversionedMaxAge time.Duration
+	ReloadTemplates   bool
+	Gzip              bool
+}
+
+var logLevels = map[string]gommonlog.Lvl{
+	"debug": gommonlog.DEBUG,
+	"info":  gommonlog.INFO,
+	"warn":  gommonlog.WARN,
+	"error": gommonlog.ERROR,
+	"off":   gommonlog.OFF,
+}
+
+func loadConfig() (Config, error) {
+	cfg := Config{
+		Host:         os.Getenv("HOST"),
+		Port:         envOr("PORT", "8080"),
+		BodyLimit:    envOr("BODY_LIMIT", defaultBodyLimit),
+		LogLevel:     strings.ToLower(envOr("LOG_LEVEL", "info")),
+		AppEnv:       envOr("APP_ENV", "development"),
+		Domain:       os.Getenv("DOMAIN"),
+		CertCacheDir: envOr("CERT_CACHE_DIR", defaultCertCacheDir),
+	}
+
+	if _, err := gommonbytes.Parse(cfg.BodyLimit); err != nil {
+		return cfg, errors.New("BODY_LIMIT must be a size such as 512K or 2M, got " + strconv.Quote(cfg.BodyLimit))
+	}
+
+	// static files are checked with the server on every request in
+	// development, so edits show up without a hard refresh
+	staticMaxAge, unversionedMaxAge := defaultStaticMaxAge, defaultUnversionedMaxAge
+	if cfg.AppEnv == "development" {
+		staticMaxAge, unversionedMaxAge = 0, 0
+	}
+
+	durations := []struct {
+		key      string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"READ_TIMEOUT", &cfg.ReadTimeout, defaultReadTimeout},
+		{"WRITE_TIMEOUT", &cfg.WriteTimeout, defaultWriteTimeout},
+		{"IDLE_TIMEOUT", &cfg.IdleTimeout, defaultIdleTimeout},
+		{"STATIC_MAX_AGE", &cfg.StaticMaxAge, staticMaxAge},
+		{"STATIC_UNVERSIONED_MAX_AGE", &cfg.UnversionedMaxAge, unversionedMaxAge},
+	}
+	for _, d := range durations {
+		value, err := durationEnv(d.key, d.fallback)
+		if err != nil {
+			return cfg, err
+		}
+		*d.value = value
+	}
+
+	if _, ok := logLevels[cfg.LogLevel]; !ok {
+		return cfg, errors.New("LOG_LEVEL must be debug, info, warn, error or off, got " + strconv.Quote(cfg.LogLevel))
+	}
+
+	reload, err := boolEnv("RELOAD_TEMPLATES", cfg.AppEnv == "development")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ReloadTemplates = reload
+
+	gzip, err := boolEnv("GZIP", true)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Gzip = gzip
+
+	return cfg, nil
+}
+
+// loadEnvFiles copies settings from the .env files into the environment.
+// .env.local and then .env.<APP_ENV>, such as .env.production, take priority
+// over .env, and variables already set in the real environment win over all
+// of them. Missing files are skipped, in production everything may come from
+// the real environment.
+func loadEnvFiles() error {
+	appEnv := os.Getenv("APP_ENV")
+	if appEnv == "" {
+		base, err := godotenv.Read(".env")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New(".env: " + err.Error())
+		}
+		appEnv = base["APP_ENV"]
+	}
+	if appEnv == "" {
+		appEnv = "development"
+	}
+
+	// godotenv never overwrites a variable that is already set, so the files
+	// are loaded from the highest priority down
+	for _, name := range []string{".env.local", ".env." + appEnv, ".env"} {
+		err := godotenv.Load(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return errors.New(name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// boolEnv reads a true or false setting, falling back when it is unset.
+func boolEnv(key string, fallback bool) (bool, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return fallback, errors.New(key + " must be true or false, got " + strconv.Quote(raw))
+	}
+
+	return value, nil
+}
+
+// durationEnv reads a setting such as 30s or 2m, falling back when it is
+// unset. Zero turns the timeout off.
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil || value < 0 {
+		return fallback, errors.New(key + " must be a duration such as 30s or 2m, got " + strconv.Quote(raw))
+	}
+
+	return value, nil
+}
+
+// listenAddr joins HOST and PORT, an empty HOST listens on every interface
+// while HOST=127.0.0.1 keeps the app local to the machine.
+func (cfg Config) listenAddr() string {
+	return net.JoinHostPort(cfg.Host, cfg.Port)
+}
+
+const (
+	httpPort  = "80"
+	httpsPort = "443"
+)
+
+// autoTLS is on when DOMAIN is set in production, the app then serves HTTPS
+// itself with certificates from Let's Encrypt instead of HTTP on PORT.
+func (cfg Config) autoTLS() bool {
+	return cfg.Domain != "" && cfg.AppEnv == "production"
+}
+
+// startServer serves plain HTTP on PORT, or with autoTLS HTTPS on 443. The
+// certificates are cached in CERT_CACHE_DIR so restarts do not ask Let's
+// Encrypt for new ones, and port 80 answers its challenges and redirects
+// everything else to HTTPS.
+func startServer(e *echo.Echo, cfg Config) error {
+	if !cfg.autoTLS() {
+		return e.Start(cfg.listenAddr())
+	}
+
+	e.AutoTLSManager.HostPolicy = autocert.HostWhitelist(cfg.Domain)
+	e.AutoTLSManager.Cache = autocert.DirCache(cfg.CertCacheDir)
+
+	redirect := &http.Server{
+		Addr:        net.JoinHostPort(cfg.Host, httpPort),
+		Handler:     e.AutoTLSManager.HTTPHandler(nil),
+		ReadTimeout: cfg.ReadTimeout,
+	}
+	e.TLSServer.RegisterOnShutdown(func() { redirect.Close() })
+
+	go func() {
+		if err := redirect.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			e.Logger.Error("serving the HTTPS redirect: ", err)
+		}
+	}()
+
+	return e.StartAutoTLS(net.JoinHostPort(cfg.Host, httpsPort))
+}
+
+// healthcheck lets the binary probe its own /healthz endpoint, which is what
+// the Dockerfile HEALTHCHECK runs as the distroless image has no curl.
+func healthcheck(cfg Config) int {
+	client := http.Client{Timeout: 5 * time.Second}
+
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+
+	url := "http://" + net.JoinHostPort(host, cfg.Port) + "/healthz"
+	if cfg.autoTLS() {
+		// the certificate is for DOMAIN rather than localhost
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{ServerName: cfg.Domain}}
+		url = "https://" + net.JoinHostPort(host, httpsPort) + "/healthz"
+	}
+
+	res, err := client.Get(url)
+	if err != nil {
+		fmt.Println("healthcheck failed: ", err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Println("healthcheck failed with status: ", res.StatusCode)
+		return 1
+	}
+
+	return 0
+}
+
+func healthzHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{
+			"status": "ok",
+		})
+	}
+}
+
+// ErrorData is passed to error.html.
+type ErrorData struct {
+	Status  int
+	Title   string
+	Message string
+}
+
+// errorHandler replaces echo's default so that every failed request, whether
+// a handler returned an error or no route matched, gets error.html with the
+// right status code and JSON clients get {"message": ...}. Server errors are
+// logged and shown with a generic message so internals never leak.
+func errorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status := http.StatusInternalServerError
+	message := "Oops! It appears we have had an error, please try again later."
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+		if text, ok := httpErr.Message.(string); ok && status < 500 {
+			message = text
+		}
+	}
+
+	if status >= 500 {
+		log.Println("error handling " + c.Request().Method + " " + c.Request().URL.Path + ": " + err.Error())
+	}
+
+	switch {
+	case c.Request().Method == http.MethodHead:
+		err = c.NoContent(status)
+	case strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON):
+		err = c.JSON(status, map[string]string{
+			"message": message,
+		})
+	default:
+		err = c.Render(status, "error", ErrorData{
+			Status:  status,
+			Title:   http.StatusText(status),
+			Message: message,
+		})
+		if err != nil {
+			fmt.Println("error rendering error page: ", err)
+			err = c.String(status, message)
+		}
+	}
+
+	if err != nil {
+		fmt.Println("error sending error response: ", err)
+	}
+}
+
+// compressedExtensions are file types that are already compressed, so
+// gzipping them again costs CPU and saves nothing.
+var compressedExtensions = map[string]bool{
+	".avif":  true,
+	".gif":   true,
+	".gz":    true,
+	".ico":   true,
+	".jpeg":  true,
+	".jpg":   true,
+	".mp4":   true,
+	".pdf":   true,
+	".png":   true,
+	".webm":  true,
+	".webp":  true,
+	".woff":  true,
+	".woff2": true,
+	".zip":   true,
+}
+
+// skipGzip leaves out already compressed files and range requests, since the
+// byte ranges a client asks for are offsets into the uncompressed file.
+func skipGzip(c echo.Context) bool {
+	if c.Request().Header.Get("Range") != "" {
+		return true
+	}
+
+	return compressedExtensions[strings.ToLower(path.Ext(c.Request().URL.Path))]
+}
+
+// cacheStatic sets Cache-Control on static files. Versioned files, the ones
+// requested with the ?v= that asset adds, are kept for versioned and marked
+// immutable, as their URL changes with their content. Anything else is kept
+// for unversioned. A max age of 0 sends no-cache, so browsers and CDNs check
+// with the server every time.
+func cacheStatic(versioned time.Duration, unversioned time.Duration) echo.MiddlewareFunc {
+	versionedHeader := cacheControl(versioned, true)
+	unversionedHeader := cacheControl(unversioned, false)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.QueryParam("v") != "" {
+				c.Response().Header().Set("Cache-Control", versionedHeader)
+			} else {
+				c.Response().Header().Set("Cache-Control", unversionedHeader)
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func cacheControl(maxAge time.Duration, immutable bool) string {
+	if maxAge <= 0 {
+		return "no-cache"
+	}
+
+	value := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	if immutable {
+		value += ", immutable"
+	}
+
+	return value
+}
+
+func pageHandler(name string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.Render(200, name, nil)
+	}
+}
@@ -0,0 +1,5 @@
+
+.PHONY: seed
+
+seed:
+	go run $(MAIN) seed
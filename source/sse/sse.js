@@ -0,0 +1,59 @@
+// A small htmx extension for server-sent events. It reads the same
+// sse-connect and sse-swap attributes as the official htmx-ext-sse, so that
+// can be dropped in instead when you need reconnection tuning or sse
+// triggers.
+(function () {
+  var api;
+
+  htmx.defineExtension("sse", {
+    init: function (internalAPI) {
+      api = internalAPI;
+    },
+
+    getSelectors: function () {
+      return ["[sse-connect]"];
+    },
+
+    onEvent: function (name, evt) {
+      var elt = evt.detail.elt;
+
+      if (name === "htmx:afterProcessNode" && elt.hasAttribute("sse-connect")) {
+        connect(elt);
+      }
+
+      // the page is being swapped out, for example by a boosted link
+      if (name === "htmx:beforeCleanupElement" && elt.sseSource) {
+        elt.sseSource.close();
+        delete elt.sseSource;
+      }
+    },
+  });
+
+  function connect(elt) {
+    if (elt.sseSource) {
+      return;
+    }
+
+    var source = new EventSource(elt.getAttribute("sse-connect"));
+    elt.sseSource = source;
+
+    var targets = [elt].concat(Array.from(elt.querySelectorAll("[sse-swap]")));
+    targets.forEach(function (target) {
+      var names = target.getAttribute("sse-swap");
+      if (!names) {
+        return;
+      }
+
+      names.split(",").forEach(function (name) {
+        source.addEventListener(name.trim(), function (event) {
+          if (!document.body.contains(elt)) {
+            source.close();
+            return;
+          }
+
+          htmx.swap(target, event.data, api.getSwapSpecification(target));
+        });
+      });
+    });
+  }
+})();
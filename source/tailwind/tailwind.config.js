@@ -0,0 +1,8 @@
+/** @type {import('tailwindcss').Config} */
+module.exports = {
+  content: ["./template/**/*.html"],
+  theme: {
+    extend: {},
+  },
+  plugins: [],
+}